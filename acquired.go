@@ -0,0 +1,22 @@
+package ratelimit
+
+import "context"
+
+// Acquired waits for a slot in the background, to use the limiter in a select statement.
+// The granted channel is closed once a slot has been consumed. If ctx or the limiter is
+// done first, granted is never closed and the reason is sent on errc.
+// Cancel ctx when the result is not needed anymore (e.g. another case of the select
+// was chosen), otherwise the slot is consumed for nothing.
+func (r *RateLimit) Acquired(ctx context.Context) (granted <-chan struct{}, errc <-chan error) {
+	g := make(chan struct{})
+	e := make(chan error, 1)
+	go func() {
+		r.setLastCall()
+		if _, err := r.acquire(ctx); err != nil {
+			e <- err
+			return
+		}
+		close(g)
+	}()
+	return g, e
+}
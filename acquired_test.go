@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquiredInASelect(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	granted, errc := r.Acquired(context.Background())
+	select {
+	case <-granted:
+	case err := <-errc:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("slot available but not granted")
+	}
+	if r.Remaining() != 0 {
+		t.Fatal("the slot was not consumed")
+	}
+
+	// limit reached: the timeout wins and the call is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	granted, errc = r.Acquired(ctx)
+	select {
+	case <-granted:
+		t.Fatal("slot granted over the limit")
+	case err := <-errc:
+		t.Fatal(err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("errc = %v, want context.Canceled", err)
+	}
+	select {
+	case <-granted:
+		t.Fatal("granted closed after the cancellation")
+	default:
+	}
+	if got := r.Stats().Acquired; got != 1 {
+		t.Fatalf("%d slots acquired, want 1", got)
+	}
+}
+
+func TestAcquiredConsumesTheSlotWhenClosing(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	granted, errc := r.Acquired(context.Background())
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	r.ForceRefill()
+	select {
+	case <-granted:
+	case err := <-errc:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("not granted after the refill")
+	}
+	if r.Remaining() != 0 {
+		t.Fatal("granted closed before the slot was consumed")
+	}
+}
+
+func TestAcquiredOnStoppedLimiter(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+	_, errc := r.Acquired(context.Background())
+	if err := <-errc; !errors.Is(err, ErrStopped) {
+		t.Fatalf("errc = %v, want ErrStopped", err)
+	}
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import "context"
+
+// WaitN waits until n slots are available and takes them at once, as AcquireN
+func (r *RateLimit) WaitN(n int) error {
+	return r.WaitNContext(context.Background(), n)
+}
+
+// WaitNContext is WaitN until ctx is done, as WaitContext. The waiting calls of several
+// slots are served in turn: the first one holds back the slots of the limiter, the other
+// calls being denied, until it gets its n slots, so that it's not starved by a stream
+// of calls of one slot. It returns ErrInvalidParams if n <= 0 or if n > 1 with a Store,
+// ErrExceedsLimit if n exceeds MaxN, even once waiting (see SetLimit).
+func (r *RateLimit) WaitNContext(ctx context.Context, n int) error {
+	if err := r.checkN(n); err != nil {
+		return err
+	}
+	r.setLastCall()
+	_, err := r.acquireN(ctx, n)
+	return err
+}
+
+// AcquireN waits until n slots are available and takes them at once, for calls costing
+// more than one slot (e.g. a batch request). The other calls never see a part of the n
+// slots taken. It returns ErrInvalidParams if n <= 0 or if n > 1 with a Store,
+// ErrExceedsLimit if n slots can never be available at once (see MaxN),
+// ErrStopped if the limiter is stopped.
+func (r *RateLimit) AcquireN(n int) error {
+	if err := r.checkN(n); err != nil {
+		return err
+	}
+	r.setLastCall()
+	_, err := r.acquireN(context.Background(), n)
+	return err
+}
+
+// TryAcquireN takes n slots at once if they are available, without waiting, and returns
+// true if it got them. It returns false if n <= 0, n > 1 with a Store or n exceeds MaxN.
+func (r *RateLimit) TryAcquireN(n int) bool {
+	if r.checkN(n) != nil {
+		return false
+	}
+	r.setLastCall()
+	if r.tryTake(n).Granted {
+		return true
+	}
+	r.limitReached()
+	r.overflow("", "limit reached")
+	return false
+}
+
+// MaxN returns the largest number of slots which can be available at once: the limit,
+// the smallest one with tiers, or the calls admitted by the burst with GCRA and TokenBucket.
+// It's 1 with a Store, which takes one slot at a time.
+func (r *RateLimit) MaxN() int {
+	if r.store != nil {
+		return 1
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	maxN := r.limit
+	switch r.algorithm {
+	case GCRA, LeakyBucket:
+		maxN = int(r.gcraBurst/r.emissionIntervalLocked()) + 1
+	case TokenBucket:
+		maxN = int(r.bucketCapacity(r.limit))
+	}
+	for _, t := range r.tiers {
+		maxN = min(maxN, t.Limit)
+	}
+	return maxN
+}
+
+// checkN returns the error of a request of n slots at once
+func (r *RateLimit) checkN(n int) error {
+	switch {
+	case n <= 0, n > 1 && r.store != nil:
+		// a Store cannot take several slots at once
+		return ErrInvalidParams
+	case n > r.MaxN():
+		return ErrExceedsLimit
+	}
+	return nil
+}
+
+// claim is held by a waiting call of several slots, see WaitNContext. It's not empty:
+// the pointers to distinct zero-size values can be equal, the claims must not.
+type claim struct{ _ byte }
+
+// claimLocked returns true if a call holding c (nil for none) can take slots: the slots
+// are held back for the call holding the claim of the limiter, if any. A waiting call
+// of several slots gets the claim if it's free. r.mu must be held for writing.
+func (r *RateLimit) claimLocked(c *claim) bool {
+	if r.claim == nil {
+		r.claim = c
+	}
+	return r.claim == nil || r.claim == c
+}
+
+// unclaim releases the claim c, if held, and wakes up the waiting calls
+func (r *RateLimit) unclaim(c *claim) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.claim == c {
+		r.claim = nil
+		r.wakeLocked()
+	}
+}
+
+// heldBack returns true if the slots are held back from a call holding c (nil for none):
+// the limiter is paused or another call holds the claim. Resume and unclaim wake up
+// the waiting calls.
+func (r *RateLimit) heldBack(c *claim) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused || r.claim != nil && r.claim != c
+}
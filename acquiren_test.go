@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireNOfOneIsAcquire(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.AcquireN(1); err != nil {
+		t.Fatal(err)
+	}
+	if !r.TryAcquireN(1) || r.TryAcquireN(1) || r.Remaining() != 0 {
+		t.Fatal("AcquireN(1) and TryAcquireN(1) do not take one slot each")
+	}
+}
+
+func TestAcquireNInvalid(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, tc := range []struct {
+		n    int
+		want error
+	}{{0, ErrInvalidParams}, {-1, ErrInvalidParams}, {4, ErrExceedsLimit}} {
+		if err := r.AcquireN(tc.n); !errors.Is(err, tc.want) {
+			t.Errorf("AcquireN(%d) = %v, want %v", tc.n, err, tc.want)
+		}
+		if r.TryAcquireN(tc.n) {
+			t.Errorf("TryAcquireN(%d) granted", tc.n)
+		}
+	}
+	if r.Remaining() != 3 {
+		t.Fatal("slots taken by invalid calls")
+	}
+}
+
+func TestAcquireNWithAStore(t *testing.T) {
+	store := &memStore{taken: 2}
+	r, err := New(context.Background(), time.Hour, 3, WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if r.MaxN() != 1 {
+		t.Fatalf("MaxN() = %d with a store, want 1", r.MaxN())
+	}
+	if err := r.AcquireN(2); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("AcquireN(2) = %v with a store, want ErrInvalidParams", err)
+	}
+	if r.TryAcquireN(2) {
+		t.Fatal("TryAcquireN(2) granted with a store")
+	}
+	// no slot of the store was lost
+	if store.taken != 2 || !r.TryAcquireN(1) || store.taken != 3 {
+		t.Fatalf("%d slots taken from the store, want 3", store.taken)
+	}
+}
+
+func TestAcquireNConcurrentMixedSizes(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 5, WithClock(clock), WithOnWindowEnd(func(count int, _, _ time.Time) {
+		if count > 5 {
+			t.Errorf("%d slots granted in a window of 5", count)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := 1 + i%3
+			if err := r.AcquireN(n); err != nil {
+				t.Errorf("AcquireN(%d) = %v", n, err)
+				return
+			}
+			granted.Add(int64(n))
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	// 39 slots requested, 5 per window
+	for windows := 0; ; windows++ {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Millisecond):
+			if windows > 40 {
+				t.Fatalf("%d slots granted after %d windows, want 39", granted.Load(), windows)
+			}
+			clock.Advance(time.Minute)
+			continue
+		}
+		break
+	}
+	if got := granted.Load(); got != 39 {
+		t.Fatalf("%d slots granted, want 39", got)
+	}
+}
+
+func TestClaimsAreDistinct(t *testing.T) {
+	a, b := &claim{}, &claim{}
+	if a == b {
+		t.Fatal("two claims are the same")
+	}
+}
+
+func TestWaitNIsNotStarvedBySmallCalls(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 5, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := r.WaitN(1); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		r.Stop()
+		wg.Wait()
+	}()
+	large := make(chan error, 1)
+	go func() { large <- r.WaitN(5) }()
+	for windows := 0; ; windows++ {
+		select {
+		case err := <-large:
+			if err != nil {
+				t.Fatalf("WaitN(5) = %v", err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+			if windows > 10 {
+				t.Fatalf("WaitN(5) starved for %d windows", windows)
+			}
+			clock.Advance(time.Minute)
+		}
+	}
+}
+
+func TestWaitNFailsWhenTheLimitIsLowered(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithGCRA(time.Hour)}, {WithAlgorithm(SlidingWindowLog)}} {
+		r, err := New(context.Background(), time.Hour, 5, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AcquireN(2)
+		errs := make(chan error, 1)
+		go func() { errs <- r.WaitN(5) }()
+		eventually(t, func() bool { return r.Waiters() == 1 })
+		if err := r.SetLimit(2); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrExceedsLimit) {
+				t.Fatalf("WaitN(5) = %v after SetLimit(2), want ErrExceedsLimit", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN(5) still waiting after SetLimit(2)")
+		}
+		// the claim is released, the other calls are served again
+		r.Reset()
+		if !r.Allow() {
+			t.Fatal("call denied after the claim was given up")
+		}
+		r.Stop()
+	}
+}
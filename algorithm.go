@@ -0,0 +1,49 @@
+package ratelimit
+
+// Algorithm is the way a limiter spreads the calls over time
+type Algorithm int
+
+const (
+	// FixedWindow allows limit calls per window, all the slots are freed at the end of
+	// the window. It's the default.
+	FixedWindow Algorithm = iota
+	// GCRA spaces the calls by d/limit on average (see WithGCRA)
+	GCRA
+	// TokenBucket refills a bucket of limit tokens (see WithBurst) continuously at
+	// limit/d tokens per second, each call takes a token: the calls can burst up to the
+	// capacity of the bucket after an idle time, then they are spread at the limited rate.
+	TokenBucket
+	// SlidingWindowLog keeps the time of the calls and admits a call only if fewer than
+	// limit calls happened during the trailing duration: unlike FixedWindow, no duration
+	// ever holds more than limit calls, even across the refills. It keeps up to limit times.
+	SlidingWindowLog
+	// LeakyBucket releases the calls one at a time, every d/limit: a strictly even
+	// spacing without burst. It's GCRA with no burst.
+	LeakyBucket
+)
+
+// String returns the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case FixedWindow:
+		return "fixed_window"
+	case GCRA:
+		return "gcra"
+	case TokenBucket:
+		return "token_bucket"
+	case SlidingWindowLog:
+		return "sliding_window_log"
+	case LeakyBucket:
+		return "leaky_bucket"
+	default:
+		return "unknown"
+	}
+}
+
+// WithAlgorithm selects the algorithm of the limiter (FixedWindow by default).
+// WithAlgorithm(GCRA) is WithGCRA(0).
+func WithAlgorithm(a Algorithm) Option {
+	return func(r *RateLimit) {
+		r.algorithm = a
+	}
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Builder builds a RateLimit with a self-documenting syntax:
+//
+//	r, err := ratelimit.Limit(20).Per(time.Second).Build(ctx)
+type Builder struct {
+	limit int
+	d     time.Duration
+	opts  []Option
+}
+
+// Limit starts a Builder allowing limit calls per window
+func Limit(limit int) *Builder {
+	return &Builder{limit: limit}
+}
+
+// Per sets the duration of the window
+func (b *Builder) Per(d time.Duration) *Builder {
+	b.d = d
+	return b
+}
+
+// With adds options given to New
+func (b *Builder) With(opts ...Option) *Builder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Build returns the RateLimit, parameters are validated like New does
+func (b *Builder) Build(ctx context.Context) (*RateLimit, error) {
+	return New(ctx, b.d, b.limit, b.opts...)
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	r, err := Limit(20).Per(time.Second).With(WithName("api")).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	st := r.Stats()
+	if st.Limit != 20 || st.WindowDuration != time.Second {
+		t.Fatalf("built %d per %v, want 20 per 1s", st.Limit, st.WindowDuration)
+	}
+}
+
+func TestBuilderValidatesLikeNew(t *testing.T) {
+	for _, b := range []*Builder{
+		Limit(0).Per(time.Second),
+		Limit(-1).Per(time.Second),
+		Limit(1),
+		Limit(1).Per(-time.Second),
+	} {
+		if _, err := b.Build(context.Background()); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Limit(%d).Per(%v).Build() = %v, want ErrInvalidParams", b.limit, b.d, err)
+		}
+	}
+}
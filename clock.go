@@ -0,0 +1,101 @@
+package ratelimit
+
+import "time"
+
+// Clock is the source of time of a limiter, it can be replaced by a fake clock
+// in tests (see WithClock)
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer delivers a single event, as time.Timer. The timers of AfterFunc have no channel.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals, as time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// realClock is the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{t: time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{t: time.AfterFunc(d, f)}
+}
+
+// realTicker is the Ticker of the time package
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTicker) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
+
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
+
+// realTimer is the Timer of the time package
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// WithClock replaces the clock of the limiter (the time package by default).
+// It gives the current time (as WithNowFunc), the ticker refilling the windows and
+// all the delays (waiting calls, penalty cooldown, TTL, progress callbacks, Stop waiting
+// for the background goroutine), so that a fake clock makes the windows end, the
+// waiting calls get their slots and Stop complete when it's advanced. The deadlines of
+// the contexts given to the calls remain in real time.
+func WithClock(c Clock) Option {
+	return func(r *RateLimit) {
+		if c != nil {
+			r.clock = c
+			r.now = c.Now
+		}
+	}
+}
+
+// stopTimer stops t, if any
+func stopTimer(t Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
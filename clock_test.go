@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which only moves when it's advanced
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a timer, a ticker (period > 0) or a function (f != nil) of a fakeClock
+type fakeTimer struct {
+	clock  *fakeClock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+	f      func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{c.add(&fakeTimer{period: d, ch: make(chan time.Time, 1)}, d)}
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(&fakeTimer{ch: make(chan time.Time, 1)}, d)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(&fakeTimer{f: f}, d)
+}
+
+func (c *fakeClock) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.clock, t.at = c, c.now.Add(d)
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers due in order
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			c.removeLocked(next)
+		}
+		if next.f != nil {
+			c.mu.Unlock()
+			next.f()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// Timers returns the number of pending timers and functions, tickers excluded
+func (c *fakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.period == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *fakeClock) removeLocked(t *fakeTimer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Reset(d time.Duration) {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.removeLocked(t)
+	t.at, t.period = t.clock.now.Add(d), d
+	t.clock.timers = append(t.clock.timers, t)
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.removeLocked(t)
+}
+
+// fakeTicker is a fakeTimer with a period
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+// eventually fails the test if cond is not true within a second
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+	}
+}
+
+func TestFakeClockRefillsTheWindow(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	r.IsLimitReached()
+	if !r.IsLimitReached() {
+		t.Fatal("limit not reached after 2 calls")
+	}
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.Remaining() == 2 })
+}
+
+func TestFakeClockWakesTheWaitingCalls(t *testing.T) {
+	for _, algorithm := range []Algorithm{FixedWindow, GCRA, TokenBucket, SlidingWindowLog, LeakyBucket} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			clock := newFakeClock()
+			r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithAlgorithm(algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			if err := r.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() { done <- r.Wait() }()
+			eventually(t, func() bool { return clock.Timers() == 1 })
+			select {
+			case err := <-done:
+				t.Fatalf("the call did not wait: %v", err)
+			default:
+			}
+			clock.Advance(time.Minute)
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("the call is still waiting")
+			}
+		})
+	}
+}
+
+func TestFakeClockEndsTheTTL(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Second, 1, WithClock(clock), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	clock.Advance(time.Hour)
+	eventually(t, func() bool { return errors.Is(r.Wait(), ErrStopped) })
+}
+
+func TestFakeClockEvictsIdleKeys(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k, err := NewKeyed(ctx, time.Second, 1, WithLimiterOptions(WithClock(clock)), WithIdleTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.IsLimitReached("a")
+	clock.Advance(2 * time.Minute)
+	eventually(t, func() bool { return k.Stats().Keys == 0 })
+}
+
+func TestFakeClockEndsTheStopJoin(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	defer close(release)
+	called := make(chan struct{})
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithOnWindowEnd(func(int, time.Time, time.Time) {
+		close(called)
+		<-release // the background goroutine does not exit
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	<-called
+	stopped := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+	eventually(t, func() bool { return clock.Timers() == 1 })
+	select {
+	case <-stopped:
+		t.Fatal("Stop did not wait for the goroutines")
+	default:
+	}
+	start := time.Now()
+	clock.Advance(stopJoinTimeout)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return at the timeout of the clock")
+	}
+	if elapsed := time.Since(start); elapsed >= stopJoinTimeout {
+		t.Fatalf("Stop waited %v of real time", elapsed)
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// RateAndConcurrency limits both the rate of operations, with a RateLimit,
+// and the number of operations running at the same time
+type RateAndConcurrency struct {
+	rl  *RateLimit
+	sem chan struct{}
+}
+
+// NewRateAndConcurrency returns a RateAndConcurrency allowing the rate of rl
+// and no more than maxConcurrent operations in progress
+func NewRateAndConcurrency(rl *RateLimit, maxConcurrent int) (*RateAndConcurrency, error) {
+	if rl == nil {
+		return nil, errors.New("ratelimit: rate limit cannot be nil")
+	}
+	if maxConcurrent <= 0 {
+		return nil, errors.New("ratelimit: maxConcurrent cannot be <= 0")
+	}
+	return &RateAndConcurrency{
+		rl:  rl,
+		sem: make(chan struct{}, maxConcurrent),
+	}, nil
+}
+
+// Acquire blocks until a concurrency slot and a rate slot are available or ctx is done
+// (or the limiter is stopped).
+// The concurrency slot is taken first so that the rate slot is only consumed when the
+// operation can really start. The returned release function frees the concurrency slot,
+// it must be called once the operation is over (calling it several times is harmless).
+func (c *RateAndConcurrency) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.rl.done:
+		return nil, c.rl.stoppedErr()
+	}
+	c.rl.setLastCall()
+	if _, err := c.rl.acquire(ctx); err != nil {
+		<-c.sem
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-c.sem })
+	}, nil
+}
+
+// InFlight returns the number of operations currently holding a concurrency slot
+func (c *RateAndConcurrency) InFlight() int {
+	return len(c.sem)
+}
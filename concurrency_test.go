@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateAndConcurrencyEnforcesBoth(t *testing.T) {
+	rl, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	c, err := NewRateAndConcurrency(rl, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release1, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.InFlight() != 2 {
+		t.Fatalf("InFlight() = %d, want 2", c.InFlight())
+	}
+
+	// concurrency exhausted: the rate slot must not be consumed
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() with 2 in flight = %v, want DeadlineExceeded", err)
+	}
+	if rl.Remaining() != 1 {
+		t.Fatalf("Remaining() = %d, want 1", rl.Remaining())
+	}
+
+	release1()
+	release1() // harmless
+	release3, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2()
+	release3()
+
+	// concurrency available, rate exhausted
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx); err == nil {
+		t.Fatal("Acquire() succeeded with the rate exhausted")
+	}
+	if c.InFlight() != 0 {
+		t.Fatalf("InFlight() = %d after a failed Acquire, want 0", c.InFlight())
+	}
+}
+
+func TestRateAndConcurrencyUnderLoad(t *testing.T) {
+	const limit, maxConcurrent = 20, 3
+	rl, err := New(context.Background(), time.Hour, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	c, err := NewRateAndConcurrency(rl, maxConcurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inFlight, maxInFlight, granted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 2*limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			release, err := c.Acquire(ctx)
+			if err != nil {
+				return
+			}
+			defer release()
+			atomic.AddInt64(&granted, 1)
+			n := atomic.AddInt64(&inFlight, 1)
+			for {
+				m := atomic.LoadInt64(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > maxConcurrent {
+		t.Errorf("%d operations in flight, want at most %d", maxInFlight, maxConcurrent)
+	}
+	if granted != limit {
+		t.Errorf("%d operations granted, want %d", granted, limit)
+	}
+}
+
+func TestNewRateAndConcurrencyInvalidParams(t *testing.T) {
+	rl, err := New(context.Background(), time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	if _, err := NewRateAndConcurrency(nil, 1); err == nil {
+		t.Error("no error with a nil rate limit")
+	}
+	if _, err := NewRateAndConcurrency(rl, 0); err == nil {
+		t.Error("no error with maxConcurrent = 0")
+	}
+}
+
+func TestStopUnblocksTheWaitingCalls(t *testing.T) {
+	rl, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewRateAndConcurrency(rl, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one call holds the concurrency slot and the rate slot
+	release, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	const n = 5
+	errs := make(chan error, 2*n)
+	for range n {
+		// waiting for a rate slot
+		go func() { errs <- rl.Wait() }()
+		// waiting for the concurrency slot
+		go func() {
+			_, err := c.Acquire(context.Background())
+			errs <- err
+		}()
+	}
+	eventually(t, func() bool { return rl.Waiters() == n })
+	rl.Stop()
+	for range 2 * n {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrStopped) {
+				t.Fatalf("waiting call returned %v, want ErrStopped", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiting call not unblocked by Stop")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+)
+
+// WithDebugControls enables the endpoints of DebugHandler changing the limiter
+// (pause, resume, refill, reset), they are disabled by default
+func WithDebugControls() Option {
+	return func(r *RateLimit) {
+		r.debugControls = true
+	}
+}
+
+// debugState is the document served by DebugHandler
+type debugState struct {
+	Name   string  `json:"name,omitempty"`
+	Paused bool    `json:"paused"`
+	Stats  Stats   `json:"stats"`
+	Events []Event `json:"events,omitempty"`
+}
+
+// DebugHandler returns a handler serving the live state of the limiter as JSON: Stats,
+// pause state and recent events (see WithEventRecorder). With WithDebugControls,
+// POST requests on the pause, resume, refill and reset sub paths call the matching methods.
+// It's meant to be mounted on a debug path:
+//
+//	mux.Handle("/debug/ratelimit/", http.StripPrefix("/debug/ratelimit", r.DebugHandler()))
+func (r *RateLimit) DebugHandler() http.Handler {
+	controls := map[string]func(){
+		"pause":  r.Pause,
+		"resume": r.Resume,
+		"refill": r.ForceRefill,
+		"reset":  r.Reset,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if control, ok := controls[path.Base(req.URL.Path)]; ok {
+			switch {
+			case !r.debugControls:
+				http.Error(w, "controls are disabled", http.StatusForbidden)
+				return
+			case req.Method != http.MethodPost:
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			control()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(debugState{
+			Name:   r.name,
+			Paused: r.IsPaused(),
+			Stats:  r.Stats(),
+			Events: r.RecentEvents(),
+		})
+	})
+}
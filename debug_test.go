@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// debugDoc is the document served by DebugHandler, as a client decodes it
+type debugDoc struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+	Stats  Stats  `json:"stats"`
+	Events []struct {
+		Kind string `json:"kind"`
+	} `json:"events"`
+}
+
+// serveDebug sends a request to the debug handler of r and decodes the state served
+func serveDebug(t *testing.T, r *RateLimit, method, path string) (int, debugDoc) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.DebugHandler().ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	var st debugDoc
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, st
+}
+
+func TestDebugHandlerRendersTheStats(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3, WithName("api"), WithEventRecorder(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	code, st := serveDebug(t, r, http.MethodGet, "/")
+	if code != http.StatusOK || st.Name != "api" || st.Stats.Limit != 3 || st.Stats.InUse != 1 || st.Stats.Acquired != 1 {
+		t.Fatalf("debug state %d %+v", code, st)
+	}
+	if len(st.Events) != 1 || st.Events[0].Kind != "grant" {
+		t.Fatalf("events %v, want the grant", st.Events)
+	}
+}
+
+func TestDebugHandlerControls(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3, WithDebugControls())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if code, _ := serveDebug(t, r, http.MethodGet, "/pause"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /pause: %d", code)
+	}
+	if _, st := serveDebug(t, r, http.MethodPost, "/pause"); !st.Paused || !r.IsPaused() {
+		t.Fatal("POST /pause did not pause the limiter")
+	}
+	if _, st := serveDebug(t, r, http.MethodPost, "/resume"); st.Paused || r.IsPaused() {
+		t.Fatal("POST /resume did not resume the limiter")
+	}
+	r.IsLimitReached()
+	if _, st := serveDebug(t, r, http.MethodPost, "/reset"); st.Stats.Remaining != 3 {
+		t.Fatal("POST /reset did not free the slots")
+	}
+	r.IsLimitReached()
+	if _, st := serveDebug(t, r, http.MethodPost, "/refill"); st.Stats.Remaining != 3 || atomic.LoadUint64(&r.ticks) != 1 {
+		t.Fatal("POST /refill did not refill the window")
+	}
+}
+
+func TestDebugHandlerControlsDisabledByDefault(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if code, _ := serveDebug(t, r, http.MethodPost, "/pause"); code != http.StatusForbidden || r.IsPaused() {
+		t.Fatalf("POST /pause: %d with the controls disabled", code)
+	}
+}
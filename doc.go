@@ -0,0 +1,11 @@
+// Package ratelimit limits the number of calls made during a window of time.
+//
+// A RateLimit allows limit calls per duration d, the window is reset by a
+// background goroutine every d. The limiter stops when the context given to
+// New is done: cancelling the context releases all the resources, calling Stop
+// is not needed in that case.
+//
+// All the durations computed from the clock (delays before the next slot...)
+// are clamped to 0: if the clock goes backwards, a negative duration is never
+// returned.
+package ratelimit
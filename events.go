@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an Event
+type EventKind int
+
+const (
+	// EventGrant is recorded when a slot is granted
+	EventGrant EventKind = iota
+	// EventDeny is recorded when a call reaches the limit
+	EventDeny
+	// EventWaitStart is recorded when a call starts waiting for a slot
+	EventWaitStart
+	// EventWaitEnd is recorded when a call stops waiting (slot granted or not)
+	EventWaitEnd
+	// EventRefill is recorded when the window is refilled
+	EventRefill
+	// EventReconfigure is recorded when the limiter is reconfigured
+	EventReconfigure
+)
+
+var eventKindNames = [...]string{
+	EventGrant:       "grant",
+	EventDeny:        "deny",
+	EventWaitStart:   "wait-start",
+	EventWaitEnd:     "wait-end",
+	EventRefill:      "refill",
+	EventReconfigure: "reconfigure",
+}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return "unknown"
+	}
+	return eventKindNames[k]
+}
+
+// MarshalText encodes the kind with its name
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Event is something which happened to a limiter
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind EventKind `json:"kind"`
+}
+
+// eventRing keeps the last events in a ring buffer
+type eventRing struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// WithEventRecorder records the last size events of the limiter, they are returned by
+// RecentEvents. It's meant for debugging, no event is recorded by default.
+func WithEventRecorder(size int) Option {
+	return func(r *RateLimit) {
+		if size > 0 {
+			r.events = &eventRing{events: make([]Event, size)}
+		}
+	}
+}
+
+// RecentEvents returns the recorded events, oldest first, or nil if WithEventRecorder
+// was not used
+func (r *RateLimit) RecentEvents() []Event {
+	if r.events == nil {
+		return nil
+	}
+	e := r.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.full {
+		return append([]Event(nil), e.events[:e.next]...)
+	}
+	return append(append(make([]Event, 0, len(e.events)), e.events[e.next:]...), e.events[:e.next]...)
+}
+
+// record records an event if the recorder is enabled
+func (r *RateLimit) record(kind EventKind) {
+	if r.events == nil {
+		return
+	}
+	e := r.events
+	now := r.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events[e.next] = Event{Time: now, Kind: kind}
+	e.next++
+	if e.next == len(e.events) {
+		e.next = 0
+		e.full = true
+	}
+}
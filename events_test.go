@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecentEventsInOrderAndWrapping(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithEventRecorder(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	r.IsLimitReached()
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return len(r.RecentEvents()) == 3 })
+	if err := r.SetLimit(2); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want []Event) {
+		t.Helper()
+		got := r.RecentEvents()
+		if len(got) != len(want) {
+			t.Fatalf("RecentEvents() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i].Kind != want[i].Kind || !got[i].Time.Equal(want[i].Time) {
+				t.Fatalf("RecentEvents() = %v, want %v", got, want)
+			}
+		}
+	}
+	check([]Event{
+		{start, EventGrant},
+		{start, EventDeny},
+		{start.Add(time.Minute), EventRefill},
+		{start.Add(time.Minute), EventReconfigure},
+	})
+	// the oldest event is overwritten
+	r.IsLimitReached()
+	check([]Event{
+		{start, EventDeny},
+		{start.Add(time.Minute), EventRefill},
+		{start.Add(time.Minute), EventReconfigure},
+		{start.Add(time.Minute), EventGrant},
+	})
+}
+
+func TestRecentEventsDisabledByDefault(t *testing.T) {
+	r, err := New(context.Background(), time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	if events := r.RecentEvents(); events != nil {
+		t.Fatalf("RecentEvents() = %v without WithEventRecorder", events)
+	}
+}
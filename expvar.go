@@ -0,0 +1,12 @@
+package ratelimit
+
+import "expvar"
+
+// PublishExpvar publishes the Stats of the limiter with the expvar package under name,
+// so they appear at /debug/vars. The values are computed each time the variable is read.
+// Like expvar.Publish, it panics if name is already registered.
+func (r *RateLimit) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Stats()
+	}))
+}
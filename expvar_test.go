@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// expvarRuns makes the names published unique when the tests run several times (-count)
+var expvarRuns uint64
+
+func TestPublishExpvarIsLive(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	name := fmt.Sprintf("%s_%d", t.Name(), atomic.AddUint64(&expvarRuns, 1))
+	r.PublishExpvar(name)
+	read := func() Stats {
+		var st Stats
+		if err := json.Unmarshal([]byte(expvar.Get(name).String()), &st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	if st := read(); st.InUse != 0 || st.Remaining != 5 || st.Limit != 5 {
+		t.Fatalf("initial stats %+v", st)
+	}
+	r.AcquireBatch(3)
+	if st := read(); st.InUse != 3 || st.Remaining != 2 || st.Acquired != 3 {
+		t.Fatalf("stats after 3 acquisitions %+v", st)
+	}
+}
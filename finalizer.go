@@ -0,0 +1,23 @@
+package ratelimit
+
+// WithLeakFinalizer sets a finalizer on the limiter: if it's garbage collected while it
+// has not been stopped (neither Stop called nor context cancelled), a warning is logged
+// and the limiter is torn down so that its goroutines exit.
+// It's a safety net against leaks, not a replacement for Stop or the cancellation of the
+// context. It's disabled by default as finalizers delay the collection of the limiter.
+func WithLeakFinalizer() Option {
+	return func(r *RateLimit) {
+		r.leakFinalizer = true
+	}
+}
+
+// finalize is the finalizer set by WithLeakFinalizer
+func (r *RateLimit) finalize() {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.log.Warn("RateLimit garbage collected without being stopped, call Stop or cancel its context")
+	r.teardown()
+}
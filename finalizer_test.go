@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLeakFinalizerTearsDownACollectedLimiter(t *testing.T) {
+	var logs syncBuffer
+	// the limiter is leaked without Stop, only its channels are kept
+	exited, ctxExited := func() (chan struct{}, chan struct{}) {
+		r, err := New(context.Background(), time.Millisecond, 1, WithLeakFinalizer(), WithLogger(debugLogger(&logs)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.IsLimitReached()
+		return r.exited, r.ctxExited
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ch := range []chan struct{}{exited, ctxExited} {
+		for done := false; !done; {
+			runtime.GC()
+			select {
+			case <-ch:
+				done = true
+			case <-time.After(10 * time.Millisecond):
+				if time.Now().After(deadline) {
+					t.Fatal("the goroutines of the collected limiter did not exit")
+				}
+			}
+		}
+	}
+	if logs.count("garbage collected without being stopped") != 1 {
+		t.Fatal("no warning about the leak")
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"sort"
+	"time"
+)
+
+// gapReservoirSize is the number of gaps between grants kept to compute percentiles
+const gapReservoirSize = 1024
+
+// gapReservoir keeps the last gaps between two grants in a ring buffer
+type gapReservoir struct {
+	gaps []time.Duration
+	next int
+}
+
+func (g *gapReservoir) add(d time.Duration) {
+	if len(g.gaps) < gapReservoirSize {
+		g.gaps = append(g.gaps, d)
+		return
+	}
+	g.gaps[g.next] = d
+	g.next = (g.next + 1) % gapReservoirSize
+}
+
+// GrantGaps returns percentiles of the time elapsed between two consecutive grants,
+// computed over the last grants. Low percentiles close to 0 with a high p99 show
+// bursty traffic, close values show a smooth pacing. It returns zeros before the second grant.
+func (r *RateLimit) GrantGaps() (p50, p90, p99 time.Duration) {
+	r.mu.RLock()
+	gaps := make([]time.Duration, len(r.gaps.gaps))
+	copy(gaps, r.gaps.gaps)
+	r.mu.RUnlock()
+	if len(gaps) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return percentile(gaps, 50), percentile(gaps, 90), percentile(gaps, 99)
+}
+
+// percentile returns the p-th percentile of sorted
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGrantGaps(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Hour, 200, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	if p50, p90, p99 := r.GrantGaps(); p50 != 0 || p90 != 0 || p99 != 0 {
+		t.Fatalf("GrantGaps() = %v, %v, %v before the second grant, want zeros", p50, p90, p99)
+	}
+	// a burst of 60 grants, then 38 grants a second apart and 2 after a pause
+	for range 60 {
+		r.IsLimitReached()
+	}
+	for range 38 {
+		clock.Advance(time.Second)
+		r.IsLimitReached()
+	}
+	for range 2 {
+		clock.Advance(10 * time.Second)
+		r.IsLimitReached()
+	}
+	p50, p90, p99 := r.GrantGaps()
+	if p50 != 0 || p90 != time.Second || p99 != 10*time.Second {
+		t.Fatalf("GrantGaps() = %v, %v, %v, want 0s, 1s, 10s", p50, p90, p99)
+	}
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import "time"
+
+// WithGCRA replaces the fixed window by the generic cell rate algorithm (GCRA): the calls
+// are spaced by d/limit on average, and a call is admitted as long as it's no more than
+// burst ahead of that schedule. burst = 0 allows one call every d/limit, burst = n*d/limit
+// allows n more calls at once. It avoids the bursts of the fixed window at its edges.
+// Only the theoretical arrival time (TAT) of the next call is kept.
+func WithGCRA(burst time.Duration) Option {
+	return func(r *RateLimit) {
+		r.algorithm = GCRA
+		r.gcraBurst = burst
+	}
+}
+
+// emissionIntervalLocked returns the interval between two calls at the limited rate,
+// r.mu must be held
+func (r *RateLimit) emissionIntervalLocked() time.Duration {
+	if t := r.d / time.Duration(r.limit); t > 0 {
+		return t
+	}
+	return 1
+}
+
+// gcraAvailableLocked returns the number of calls which would be admitted now, r.mu must be held
+func (r *RateLimit) gcraAvailableLocked(now time.Time) int {
+	t := r.emissionIntervalLocked()
+	tat := r.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	// a call is admitted if the TAT after the call is at most burst+t ahead of now
+	allowance := addDuration(r.gcraBurst, t) - tat.Sub(now)
+	if allowance < t {
+		return 0
+	}
+	return int(allowance / t)
+}
+
+// gcraConsumeLocked moves the TAT forward for n calls, r.mu must be held for writing
+func (r *RateLimit) gcraConsumeLocked(n int, now time.Time) {
+	if r.tat.Before(now) {
+		r.tat = now
+	}
+	r.tat = r.tat.Add(time.Duration(n) * r.emissionIntervalLocked())
+}
+
+// gcraDelayLocked returns how long to wait before n calls are admitted, r.mu must be held
+func (r *RateLimit) gcraDelayLocked(now time.Time, n int) time.Duration {
+	tat := r.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	tat = tat.Add(time.Duration(n-1) * r.emissionIntervalLocked())
+	return nonNegative(tat.Add(-r.gcraBurst).Sub(now))
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGCRAToleranceBoundary(t *testing.T) {
+	for _, tc := range []struct {
+		burst time.Duration
+		// admitted is the number of calls admitted at once
+		admitted int
+	}{{0, 1}, {200 * time.Millisecond, 3}, {250 * time.Millisecond, 3}} {
+		clock := newFakeClock()
+		// a call every 100ms
+		r, err := New(context.Background(), time.Second, 10, WithClock(clock), WithGCRA(tc.burst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tc.admitted {
+			if r.IsLimitReached() {
+				t.Fatalf("burst %v: call %d rejected", tc.burst, i)
+			}
+		}
+		if !r.IsLimitReached() {
+			t.Fatalf("burst %v: call admitted beyond the tolerance", tc.burst)
+		}
+		if got := r.NextAvailable(); got != 100*time.Millisecond-tc.burst%(100*time.Millisecond) {
+			t.Fatalf("burst %v: NextAvailable() = %v", tc.burst, got)
+		}
+		clock.Advance(r.NextAvailable() - time.Nanosecond)
+		if !r.IsLimitReached() {
+			t.Fatalf("burst %v: call admitted before the TAT", tc.burst)
+		}
+		clock.Advance(time.Nanosecond)
+		if r.IsLimitReached() || !r.IsLimitReached() {
+			t.Fatalf("burst %v: want one call admitted at the TAT", tc.burst)
+		}
+		r.Stop()
+	}
+}
+
+func TestLeakyBucketEvenSpacing(t *testing.T) {
+	clock := newFakeClock()
+	// a call every 250ms
+	r, err := New(context.Background(), time.Second, 4, WithClock(clock), WithAlgorithm(LeakyBucket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	const calls = 6
+	granted := make(chan time.Time, calls)
+	go func() {
+		for range calls {
+			r.WaitIfLimitReached()
+			granted <- clock.Now()
+		}
+	}()
+	var times []time.Time
+	for deadline := time.Now().Add(5 * time.Second); len(times) < calls; {
+		select {
+		case at := <-granted:
+			times = append(times, at)
+			continue
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls granted, want %d", len(times), calls)
+		}
+		// the clock only moves while the call is parked, so that the grants are timed exactly
+		if r.Waiters() == 1 && clock.Timers() > 0 {
+			clock.Advance(10 * time.Millisecond)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap != 250*time.Millisecond {
+			t.Fatalf("gap %d = %v, want 250ms", i, gap)
+		}
+	}
+	// no burst after an idle period
+	clock.Advance(time.Hour)
+	if r.IsLimitReached() || !r.IsLimitReached() {
+		t.Fatal("want one call admitted after an idle period")
+	}
+}
@@ -1,7 +1,3 @@
 module github.com/sgaunet/ratelimit
 
-go 1.18
-
-require github.com/sirupsen/logrus v1.9.3
-
-require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+go 1.24
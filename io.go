@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+)
+
+// Reader is an io.Reader whose throughput is limited to limit bytes per d of its
+// RateLimit, a slot per byte
+type Reader struct {
+	ctx context.Context
+	r   io.Reader
+	rl  *RateLimit
+}
+
+// NewReader returns a Reader reading from r at the rate of rl. The reads wait for the
+// slots of the bytes read, or return the error of ctx once it's done (ErrStopped once
+// rl is stopped): the copy stops instead of running unthrottled.
+func NewReader(ctx context.Context, r io.Reader, rl *RateLimit) *Reader {
+	return &Reader{ctx: ctx, r: r, rl: rl}
+}
+
+// Read reads up to len(p) bytes, no more than MaxN of the limiter at once, and waits
+// for their slots before returning them. The bytes read are returned with the error
+// if the wait fails.
+func (rd *Reader) Read(p []byte) (int, error) {
+	if err := rd.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(p) > rd.rl.MaxN() {
+		p = p[:rd.rl.MaxN()]
+	}
+	n, err := rd.r.Read(p)
+	if n > 0 {
+		rd.rl.setLastCall()
+		if _, werr := rd.rl.acquireN(rd.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Writer is an io.Writer whose throughput is limited to limit bytes per d of its
+// RateLimit, a slot per byte
+type Writer struct {
+	ctx context.Context
+	w   io.Writer
+	rl  *RateLimit
+}
+
+// NewWriter returns a Writer writing to w at the rate of rl. The writes wait for the
+// slots of the bytes before writing them, or return the error of ctx once it's done
+// (ErrStopped once rl is stopped).
+func NewWriter(ctx context.Context, w io.Writer, rl *RateLimit) *Writer {
+	return &Writer{ctx: ctx, w: w, rl: rl}
+}
+
+// Write writes p by chunks of no more than MaxN bytes of the limiter, waiting for the
+// slots of each chunk before writing it. It returns the number of bytes written.
+func (wr *Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), wr.rl.MaxN())]
+		wr.rl.setLastCall()
+		if _, err := wr.rl.acquireN(wr.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := wr.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
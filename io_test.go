@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterCopyTakesTheExpectedTime(t *testing.T) {
+	clock := newFakeClock()
+	rl, err := New(context.Background(), time.Second, 100, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	start := clock.Now()
+	var out bytes.Buffer
+	done := make(chan time.Time, 1)
+	go func() {
+		if _, err := io.Copy(NewWriter(context.Background(), &out, rl), strings.NewReader(strings.Repeat("x", 350))); err != nil {
+			t.Error(err)
+		}
+		done <- clock.Now()
+	}()
+	for {
+		select {
+		case end := <-done:
+			// 100 bytes at once, then 100 per second
+			if got := end.Sub(start); got != 3*time.Second {
+				t.Fatalf("copy of 350 bytes took %v, want 3s", got)
+			}
+			if out.Len() != 350 {
+				t.Fatalf("%d bytes written, want 350", out.Len())
+			}
+			return
+		case <-time.After(time.Millisecond):
+		}
+		if rl.Waiters() == 1 && clock.Timers() > 0 {
+			if clock.Now().Sub(start) > 10*time.Second {
+				t.Fatal("copy not done after 10s")
+			}
+			clock.Advance(time.Second)
+			waitRefill(t, rl, clock)
+		}
+	}
+}
+
+func TestReaderStopsWithTheContext(t *testing.T) {
+	rl, err := New(context.Background(), time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	got, err := io.ReadAll(NewReader(ctx, strings.NewReader(strings.Repeat("x", 100)), rl))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadAll() = %v, want context.Canceled", err)
+	}
+	// the first read gets its slots, the second one is cancelled while waiting
+	if len(got) != 20 {
+		t.Fatalf("%d bytes read, want 20", len(got))
+	}
+	if _, err := NewReader(ctx, strings.NewReader("x"), rl).Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Read() = %v with a cancelled context, want context.Canceled", err)
+	}
+}
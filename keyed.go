@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+	"weak"
+)
+
+// KeyedRateLimiter limits the calls per key (user, IP address...) with a limiter per key
+// created on first use, see Manager for the lifecycle. Use WithIdleTTL, or call EvictIdle,
+// to bound the memory used by keys seen once.
+type KeyedRateLimiter struct {
+	*Manager
+	limiterOpts []Option
+	idleTTL     time.Duration
+}
+
+// KeyedOption configures a KeyedRateLimiter created by NewKeyed
+type KeyedOption func(*KeyedRateLimiter)
+
+// WithLimiterOptions sets the options given to New for the limiter of each key
+func WithLimiterOptions(opts ...Option) KeyedOption {
+	return func(k *KeyedRateLimiter) {
+		k.limiterOpts = append(k.limiterOpts, opts...)
+	}
+}
+
+// WithIdleTTL makes a background goroutine evict the limiters not called for d
+// (see EvictIdle), it checks every d/2 and ends when the context given to NewKeyed is done.
+// The checks are driven by the clock given by WithClock in WithLimiterOptions, if any.
+func WithIdleTTL(d time.Duration) KeyedOption {
+	return func(k *KeyedRateLimiter) {
+		k.idleTTL = d
+	}
+}
+
+// NewKeyed returns a KeyedRateLimiter allowing limit calls per d for each key
+func NewKeyed(ctx context.Context, d time.Duration, limit int, opts ...KeyedOption) (*KeyedRateLimiter, error) {
+	k := &KeyedRateLimiter{}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if k.idleTTL < 0 {
+		return nil, ErrInvalidParams
+	}
+	m, err := NewManager(ctx, d, limit, k.limiterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	k.Manager = m
+	if k.idleTTL > 0 {
+		k.janitor()
+	}
+	return k, nil
+}
+
+// janitor launches the goroutine evicting the idle limiters, it only keeps a weak
+// reference to the manager so that it does not keep it alive
+func (k *KeyedRateLimiter) janitor() {
+	wm, ctx, ttl := weak.Make(k.Manager), k.ctx, k.idleTTL
+	t := clockOf(k.limiterOpts).NewTicker(max(ttl/2, MinDuration))
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+				m := wm.Value()
+				if m == nil {
+					return
+				}
+				m.EvictIdle(ttl)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// WaitIfLimitReached waits if the limit of key has been reached, it returns at once
+// when the context given to NewKeyed is done
+func (k *KeyedRateLimiter) WaitIfLimitReached(key string) {
+	if r, err := k.GetLimiter(key); err == nil {
+		r.WaitIfLimitReached()
+	}
+}
+
+// IsLimitReached returns true if the limit of key has been reached, and consumes a slot
+// of key otherwise. It returns false when the context given to NewKeyed is done.
+func (k *KeyedRateLimiter) IsLimitReached(key string) bool {
+	r, err := k.GetLimiter(key)
+	if err != nil {
+		return false
+	}
+	return r.IsLimitReached()
+}
+
+// clockOf returns the clock set by opts, the time package by default
+func clockOf(opts []Option) Clock {
+	r := RateLimit{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r.clock
+}
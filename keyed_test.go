@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimitsEachKeyIndependently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k, err := NewKeyed(ctx, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "a"} {
+		if k.IsLimitReached(key) {
+			t.Fatalf("limit of %q reached too early", key)
+		}
+	}
+	if !k.IsLimitReached("a") {
+		t.Fatal("limit of a not reached after 2 calls")
+	}
+	// b has its own window
+	done := make(chan struct{})
+	go func() {
+		k.WaitIfLimitReached("b")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("b waits for the window of a")
+	}
+	if k.IsLimitReached("b") || !k.IsLimitReached("b") {
+		t.Fatal("b does not have 2 slots")
+	}
+}
+
+func TestKeyedEvictsTheIdleKeys(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k, err := NewKeyed(ctx, time.Second, 1, WithLimiterOptions(WithClock(clock)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.IsLimitReached("idle")
+	clock.Advance(time.Minute)
+	k.IsLimitReached("active")
+	if got := k.EvictIdle(30 * time.Second); got != 1 {
+		t.Fatalf("EvictIdle() = %d, want 1", got)
+	}
+	if st := k.Stats(); st.Keys != 1 || st.Busiest[0].Key != "active" {
+		t.Fatalf("keys left %+v, want only active", st.Busiest)
+	}
+	// an evicted key gets a new limiter with a full window
+	if k.IsLimitReached("idle") {
+		t.Fatal("limit of an evicted key reached")
+	}
+}
+
+func TestIdleTTLJanitor(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k, err := NewKeyed(ctx, time.Second, 1, WithLimiterOptions(WithClock(clock)), WithIdleTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 100 {
+		k.IsLimitReached(strconv.Itoa(i))
+	}
+	if st := k.Stats(); st.Keys != 100 {
+		t.Fatalf("%d keys, want 100", st.Keys)
+	}
+	clock.Advance(2 * time.Minute)
+	eventually(t, func() bool { return k.Stats().Keys == 0 })
+	// the janitor ends with the context, its ticker is stopped
+	cancel()
+	eventually(t, func() bool {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return len(clock.timers) == 0
+	})
+}
+
+func TestGetLimiterIsNotEvictedBeforeItsUse(t *testing.T) {
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k, err := NewKeyed(ctx, time.Second, 1, WithLimiterOptions(WithClock(clock)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.IsLimitReached("a")
+	clock.Advance(2 * time.Minute)
+	r, err := k.GetLimiter("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the janitor runs between GetLimiter and the use of the limiter
+	if got := k.EvictIdle(time.Minute); got != 0 {
+		t.Fatalf("EvictIdle() = %d right after GetLimiter, want 0", got)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter is the interface implemented by RateLimit, code depending on it
+// instead of *RateLimit can use fakes in its tests or other implementations
+// (SubLimiter...)
+type Limiter interface {
+	WaitIfLimitReached()
+	WaitContext(ctx context.Context) error
+	IsLimitReached() bool
+	TryAcquire(timeout time.Duration) bool
+	GetLastCall() time.Time
+	Stop()
+}
+
+var _ Limiter = (*RateLimit)(nil)
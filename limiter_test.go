@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingLimiter is a fake Limiter as code depending on the interface would use in its tests
+type countingLimiter struct {
+	calls int
+	limit int
+}
+
+func (f *countingLimiter) WaitIfLimitReached()                   { f.calls++ }
+func (f *countingLimiter) WaitContext(ctx context.Context) error { f.calls++; return ctx.Err() }
+func (f *countingLimiter) IsLimitReached() bool                  { f.calls++; return f.calls > f.limit }
+func (f *countingLimiter) TryAcquire(time.Duration) bool         { return !f.IsLimitReached() }
+func (f *countingLimiter) GetLastCall() time.Time                { return time.Time{} }
+func (f *countingLimiter) Stop()                                 {}
+
+// admitted returns how many of n calls l admits
+func admitted(l Limiter, n int) int {
+	got := 0
+	for range n {
+		if !l.IsLimitReached() {
+			got++
+		}
+	}
+	return got
+}
+
+func TestLimiterImplementations(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	other, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	multi, err := NewMultiLimiter(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		l    Limiter
+		want int
+	}{
+		{"fake", &countingLimiter{limit: 4}, 4},
+		{"RateLimit", r, 3},
+		{"MultiLimiter", multi, 2},
+	} {
+		if got := admitted(tc.l, 10); got != tc.want {
+			t.Errorf("%s: %d calls admitted, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// waitAll waits for n slots of l, as code depending on the interface would
+func waitAll(ctx context.Context, l Limiter, n int) error {
+	for range n {
+		if err := l.WaitContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestLimiterWaitContext(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	sub := r.SubLimiter()
+	if err := waitAll(context.Background(), sub, 1); err != nil {
+		t.Fatalf("SubLimiter: %v", err)
+	}
+	if err := waitAll(context.Background(), r, 1); err != nil {
+		t.Fatalf("RateLimit: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	for _, l := range []Limiter{r, sub} {
+		if err := waitAll(ctx, l, 1); err == nil {
+			t.Fatalf("%T: slot granted over the limit", l)
+		}
+	}
+	sub.Stop()
+	if err := waitAll(context.Background(), sub, 1); !errors.Is(err, ErrStopped) {
+		t.Fatalf("stopped SubLimiter: %v, want ErrStopped", err)
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// initLog returns the logger of the limiters: debugLevel (debug, info, warn or error)
+// is the minimum level of the messages written to stdout, nothing is logged if it's empty
+func initLog(debugLevel string) *slog.Logger {
+	var level slog.Level
+	switch debugLevel {
+	case "debug":
+		level = slog.LevelDebug
+	case "info":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return slog.New(slog.DiscardHandler)
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// logGate lets an event through at most once per window, it's used to avoid
+// flooding the logs when the limit is reached by a lot of calls
+type logGate struct {
+	mu     sync.Mutex
+	last   time.Time
+	window time.Duration
+}
+
+// allow returns true if no event has been let through during the last window
+func (g *logGate) allow(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.last.IsZero() && now.Sub(g.last) < g.window && now.Sub(g.last) >= 0 {
+		return false
+	}
+	g.last = now
+	return true
+}
+
+// logLimitReached logs that the limit has been reached, at most once per window
+func (r *RateLimit) logLimitReached() {
+	if r.log.Enabled(context.Background(), slog.LevelDebug) && r.limitLog.allow(r.now()) {
+		r.log.Debug("Limit reached")
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes of the background goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) count(s string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Count(b.buf.String(), s)
+}
+
+func debugLogger(w *syncBuffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLimitReachedLoggedOncePerWindow(t *testing.T) {
+	var logs syncBuffer
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithLogger(debugLogger(&logs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for i := 0; i < 10; i++ {
+		r.IsLimitReached()
+	}
+	if n := logs.count(`msg="Limit reached"`); n != 1 {
+		t.Fatalf("%d limit reached lines during a window, want 1", n)
+	}
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.Remaining() == 1 })
+	for i := 0; i < 10; i++ {
+		r.IsLimitReached()
+	}
+	if n := logs.count(`msg="Limit reached"`); n != 2 {
+		t.Fatalf("%d limit reached lines during two windows, want 2", n)
+	}
+}
+
+func TestLogGate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := logGate{window: time.Second}
+	for _, tc := range []struct {
+		at   time.Duration
+		want bool
+	}{
+		{0, true},
+		{500 * time.Millisecond, false},
+		{999 * time.Millisecond, false},
+		{time.Second, true},
+		{1500 * time.Millisecond, false},
+		{-time.Hour, true}, // the clock went backwards
+	} {
+		if got := g.allow(start.Add(tc.at)); got != tc.want {
+			t.Errorf("allow(%v) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestInitLogSilentByDefault(t *testing.T) {
+	if initLog("").Enabled(context.Background(), slog.LevelError) {
+		t.Error("the default logger is enabled")
+	}
+	if !initLog("debug").Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug is not enabled with RATELIMIT_LOGLEVEL=debug")
+	}
+	if initLog("warn").Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info is enabled with RATELIMIT_LOGLEVEL=warn")
+	}
+}
+
+func TestInjectedLoggerReceivesDebugLines(t *testing.T) {
+	var logs syncBuffer
+	r, err := New(context.Background(), time.Hour, 1, WithLogger(debugLogger(&logs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetLimit(2); err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+	for _, line := range []string{"Start backgroundRoutine", "Limit set", "Stop Ticker"} {
+		if logs.count(line) == 0 {
+			t.Errorf("%q not logged", line)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manager holds one RateLimit per key (tenant, user...), the limiters are created
+// on first use with the same parameters
+type Manager struct {
+	ctx      context.Context
+	d        time.Duration
+	limit    int
+	opts     []Option
+	mu       sync.Mutex
+	limiters map[string]*RateLimit
+}
+
+// NewManager returns a Manager creating limiters of limit calls per d,
+// opts are given to New for each limiter.
+// The limiters are stopped when ctx is done: the manager then forgets them and
+// GetLimiter and Warm return an error wrapping ErrStopped and the error of ctx.
+func NewManager(ctx context.Context, d time.Duration, limit int, opts ...Option) (*Manager, error) {
+	if limit <= 0 || d <= 0 {
+		return nil, ErrInvalidParams
+	}
+	m := &Manager{
+		ctx:      ctx,
+		d:        d,
+		limit:    limit,
+		opts:     opts,
+		limiters: make(map[string]*RateLimit),
+	}
+	// the limiters stop themselves with ctx, the manager only has to release them
+	context.AfterFunc(ctx, m.release)
+	return m, nil
+}
+
+// release forgets all the limiters
+func (m *Manager) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.limiters)
+}
+
+// GetLimiter returns the limiter of key, it's created if needed. It counts as a call
+// of the limiter (see GetLastCall), so that EvictIdle does not stop it before it's used.
+func (m *Manager) GetLimiter(key string) (*RateLimit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getLocked(key)
+}
+
+// Warm creates the limiters of keys up front to avoid creating them on the first call.
+// Keys which already have a limiter are kept as is.
+func (m *Manager) Warm(keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if _, err := m.getLocked(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLocked returns the limiter of key and creates it if needed, m.mu must be held.
+// The last call is updated under m.mu: EvictIdle cannot tear the limiter down between
+// its lookup and its use.
+func (m *Manager) getLocked(key string) (*RateLimit, error) {
+	if err := m.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStopped, err)
+	}
+	if r, ok := m.limiters[key]; ok {
+		r.setLastCall()
+		return r, nil
+	}
+	r, err := New(m.ctx, m.d, m.limit, m.opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.limiters[key] = r
+	return r, nil
+}
+
+// EvictIdle stops and forgets the limiters not called for idle (see GetLastCall) and not
+// waited on, to bound the memory used by keys seen once, and returns how many were evicted.
+// A limiter is created again on the next call for its key, with a full window.
+func (m *Manager) EvictIdle(idle time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	evicted := 0
+	for key, r := range m.limiters {
+		if r.Waiters() > 0 || r.now().Sub(r.GetLastCall()) < idle {
+			continue
+		}
+		r.teardown()
+		delete(m.limiters, key)
+		evicted++
+	}
+	return evicted
+}
+
+// managerTopKeys is the number of busiest keys reported by Manager.Stats
+const managerTopKeys = 10
+
+// KeyStats is the activity of the limiter of a key
+type KeyStats struct {
+	Key       string `json:"key"`
+	Acquired  uint64 `json:"acquired"`
+	Throttled uint64 `json:"throttled"`
+}
+
+// ManagerStats aggregates the Stats of the limiters of a Manager
+type ManagerStats struct {
+	// Keys is the number of keys with a limiter
+	Keys      int    `json:"keys"`
+	Acquired  uint64 `json:"acquired"`
+	Throttled uint64 `json:"throttled"`
+	// Busiest are the most active keys (acquired and throttled calls), busiest first
+	Busiest []KeyStats `json:"busiest"`
+}
+
+// Stats returns the aggregated activity of all the limiters, no limiter is added or
+// removed while they are read
+func (m *Manager) Stats() ManagerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := ManagerStats{
+		Keys: len(m.limiters),
+	}
+	keys := make([]KeyStats, 0, len(m.limiters))
+	for key, r := range m.limiters {
+		st := r.Stats()
+		ms.Acquired += st.Acquired
+		ms.Throttled += st.Throttled
+		keys = append(keys, KeyStats{
+			Key:       key,
+			Acquired:  st.Acquired,
+			Throttled: st.Throttled,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ai, aj := keys[i].Acquired+keys[i].Throttled, keys[j].Acquired+keys[j].Throttled
+		if ai != aj {
+			return ai > aj
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > managerTopKeys {
+		keys = keys[:managerTopKeys]
+	}
+	ms.Busiest = keys
+	return ms
+}
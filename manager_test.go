@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWarmCreatesTheLimitersOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := NewManager(ctx, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Warm([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.GetLimiter("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsLimitReached()
+	// warming again keeps the existing limiters and their state
+	if err := m.Warm([]string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := m.GetLimiter("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != a || again.Remaining() != 1 {
+		t.Fatal("the warmed limiter was recreated")
+	}
+	if st := m.Stats(); st.Keys != 3 {
+		t.Fatalf("%d keys, want 3", st.Keys)
+	}
+}
+
+func TestWarmConcurrentWithGetLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := NewManager(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"a", "b", "c", "d"}
+	got := make([][]*RateLimit, 8)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				if err := m.Warm(keys); err != nil {
+					t.Error(err)
+				}
+			}
+			for _, key := range keys {
+				r, err := m.GetLimiter(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got[i] = append(got[i], r)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range got {
+		for j := range keys {
+			if got[i][j] != got[0][j] {
+				t.Fatalf("several limiters for key %s", keys[j])
+			}
+		}
+	}
+}
+
+func TestWarmAfterTheContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := NewManager(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := m.Warm([]string{"a"}); !errors.Is(err, ErrStopped) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Warm() = %v, want ErrStopped and context.Canceled", err)
+	}
+}
+
+func TestManagerStopsWithItsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := NewManager(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.GetLimiter("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for name, ch := range map[string]chan struct{}{"done": a.done, "background goroutine": a.exited, "context goroutine": a.ctxExited} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("%s of the child limiter not closed", name)
+		}
+	}
+	if r, err := m.GetLimiter("b"); r != nil || !errors.Is(err, ErrStopped) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetLimiter() = %v, %v, want ErrStopped and context.Canceled", r, err)
+	}
+	eventually(t, func() bool { return m.Stats().Keys == 0 })
+}
+
+func TestManagerStatsAggregatesTheKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := NewManager(ctx, time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// key-i gets i+1 calls: min(i+1, 3) acquired, the others throttled
+	var acquired, throttled uint64
+	for i := range 12 {
+		r, err := m.GetLimiter(fmt.Sprintf("key-%02d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range i + 1 {
+			r.IsLimitReached()
+		}
+		acquired += uint64(min(i+1, 3))
+		throttled += uint64(max(i+1-3, 0))
+	}
+	st := m.Stats()
+	if st.Keys != 12 || st.Acquired != acquired || st.Throttled != throttled {
+		t.Fatalf("Stats() = %d keys, %d acquired, %d throttled, want 12, %d, %d", st.Keys, st.Acquired, st.Throttled, acquired, throttled)
+	}
+	if len(st.Busiest) != managerTopKeys {
+		t.Fatalf("%d busiest keys, want %d", len(st.Busiest), managerTopKeys)
+	}
+	for i, ks := range st.Busiest {
+		if want := fmt.Sprintf("key-%02d", 11-i); ks.Key != want || ks.Acquired+ks.Throttled != uint64(12-i) {
+			t.Fatalf("busiest key %d = %+v, want %s with %d calls", i, ks, want, 12-i)
+		}
+	}
+}
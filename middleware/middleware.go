@@ -0,0 +1,59 @@
+// Package middleware throttles the inbound HTTP requests of a server with a ratelimit.RateLimit.
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/sgaunet/ratelimit"
+)
+
+// Option configures the middleware
+type Option func(*config)
+
+type config struct {
+	reject http.Handler
+}
+
+// WithRejectionHandler sets the handler serving the requests over the limit, the
+// Retry-After header is already set when it's called. By default, the response is a
+// 429 Too Many Requests with a plain text body.
+func WithRejectionHandler(h http.Handler) Option {
+	return func(c *config) {
+		if h != nil {
+			c.reject = h
+		}
+	}
+}
+
+// tooManyRequests is the default rejection handler
+func tooManyRequests(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// Middleware returns a middleware taking a slot of rl for each request without waiting:
+// the requests over the limit are rejected with a Retry-After header giving the number
+// of seconds before a slot is available (see NextAvailable). It wraps any http.Handler, e.g.:
+//
+//	http.ListenAndServe(":8080", middleware.Middleware(rl)(mux))
+func Middleware(rl *ratelimit.RateLimit, opts ...Option) func(http.Handler) http.Handler {
+	c := config{
+		reject: http.HandlerFunc(tooManyRequests),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !rl.IsLimitReached() {
+				next.ServeHTTP(w, req)
+				return
+			}
+			// Retry-After is in whole seconds, rounded up so that the retry is not too early
+			retryAfter := max(int(math.Ceil(rl.NextAvailable().Seconds())), 1)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			c.reject.ServeHTTP(w, req)
+		})
+	}
+}
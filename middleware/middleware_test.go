@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sgaunet/ratelimit"
+)
+
+func newLimiter(t *testing.T, limit int) *ratelimit.RateLimit {
+	t.Helper()
+	rl, err := ratelimit.New(context.Background(), time.Minute, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rl.Stop)
+	return rl
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestMiddlewareRejectsOverTheLimit(t *testing.T) {
+	h := Middleware(newLimiter(t, 3))(http.HandlerFunc(ok))
+	counts := map[int]int{}
+	for range 10 {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		counts[rec.Code]++
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "60" {
+			t.Fatalf("Retry-After = %q, want 60", rec.Header().Get("Retry-After"))
+		}
+	}
+	if counts[http.StatusOK] != 3 || counts[http.StatusTooManyRequests] != 7 {
+		t.Fatalf("responses %v, want 3 OK and 7 Too Many Requests", counts)
+	}
+}
+
+func TestMiddlewareRejectionHandler(t *testing.T) {
+	reject := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	h := Middleware(newLimiter(t, 1), WithRejectionHandler(reject))(http.HandlerFunc(ok))
+	codes := make([]int, 0, 2)
+	for range 2 {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rec.Code)
+		if rec.Code == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+			t.Fatal("Retry-After not set before the rejection handler")
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusServiceUnavailable {
+		t.Fatalf("responses %v, want OK then the custom rejection", codes)
+	}
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// MultiLimiter admits a call only if all its limiters allow it, e.g. 10 calls per second
+// of one and 100 calls per minute of another. Unlike NewTiered, the limiters can be
+// shared with other code and have different options.
+type MultiLimiter struct {
+	limiters []*RateLimit
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+var _ Limiter = (*MultiLimiter)(nil)
+
+// NewMultiLimiter returns a MultiLimiter taking a slot of each of limiters for each call
+func NewMultiLimiter(limiters ...*RateLimit) (*MultiLimiter, error) {
+	if len(limiters) == 0 {
+		return nil, errors.New("ratelimit: no limiter given")
+	}
+	for _, r := range limiters {
+		if r == nil {
+			return nil, errors.New("ratelimit: rate limit cannot be nil")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MultiLimiter{
+		limiters: limiters,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// WaitIfLimitReached waits until all the limiters have a slot and takes them,
+// it returns as soon as the multi limiter or one of the limiters is stopped
+func (m *MultiLimiter) WaitIfLimitReached() {
+	_ = m.WaitContext(context.Background())
+}
+
+// WaitContext waits until all the limiters have a slot and takes them, or ctx is done.
+// The slots are taken at once: a slot is not held while waiting for the others, so that
+// it's not wasted. The delays are measured with the clock of the first limiter.
+// It returns the error of ctx if ctx is done first (ErrLimitReached without waiting if
+// the deadline of ctx is before the next slots), ErrStopped once the multi limiter is
+// stopped, the error of the first stopped limiter (see Wait) if one of them is stopped,
+// ErrStopped if one of them is draining (see Shutdown) and ErrLimitReached at once while
+// the calls are shed (see SetGlobalShed).
+func (m *MultiLimiter) WaitContext(ctx context.Context) error {
+	if m.ctx.Err() != nil {
+		return ErrStopped
+	}
+	m.setLastCall()
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(m.ctx, cancel)
+	defer stop()
+	for _, r := range m.limiters {
+		stop := context.AfterFunc(r.stopCtx, cancel)
+		defer stop()
+	}
+	first := m.limiters[0]
+	for {
+		// the signal is taken before trying so that a shed cannot be missed
+		shed := globalShedSignal()
+		ok, err := m.takeAll()
+		if err != nil || ok {
+			return err
+		}
+		wait, known := m.delay()
+		if deadline, ok := ctx.Deadline(); ok && known && time.Until(deadline) < wait {
+			return ErrLimitReached
+		}
+		t := first.clock.NewTimer(wait)
+		select {
+		case <-waitCtx.Done():
+			t.Stop()
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if m.ctx.Err() != nil {
+				return ErrStopped
+			}
+		case <-shed:
+			t.Stop()
+		case <-t.C():
+		}
+	}
+}
+
+// IsLimitReached takes a slot of each limiter and returns false if they all have one,
+// it returns true otherwise without taking any. It returns false once the multi limiter
+// or one of the limiters is stopped.
+func (m *MultiLimiter) IsLimitReached() bool {
+	if m.ctx.Err() != nil {
+		return false
+	}
+	m.setLastCall()
+	ok, err := m.takeAll()
+	if err != nil {
+		// the calls are refused while shedding or draining, a stopped limiter no longer limits
+		return err == ErrLimitReached || m.isDraining()
+	}
+	return !ok
+}
+
+// TryAcquire waits up to timeout for a slot of each limiter and returns true if it got them
+func (m *MultiLimiter) TryAcquire(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.WaitContext(ctx) == nil
+}
+
+// GetLastCall returns the latest call to one of the limiters
+func (m *MultiLimiter) GetLastCall() time.Time {
+	var last time.Time
+	for _, r := range m.limiters {
+		if t := r.GetLastCall(); t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Stop stops the multi limiter only, as SubLimiter: the limiters keep working for the
+// other code sharing them. Use StopAll to stop them.
+func (m *MultiLimiter) Stop() {
+	m.cancel()
+}
+
+func (m *MultiLimiter) setLastCall() {
+	for _, r := range m.limiters {
+		r.setLastCall()
+	}
+}
+
+// takeAll takes a slot of each limiter and returns true if they all had one. Otherwise
+// the slots taken are given back (except those of a store) and it returns false, with
+// the error of the first stopped limiter if any, ErrStopped if one of them is draining
+// (see Shutdown) or ErrLimitReached while the calls are shed (see SetGlobalShed).
+func (m *MultiLimiter) takeAll() (bool, error) {
+	taken := make([]AcquireResult, 0, len(m.limiters))
+	giveBack := func() {
+		for i, res := range taken {
+			if !res.grantedAt.IsZero() {
+				m.limiters[i].giveBack(res.generation, res.grantedAt)
+			}
+		}
+	}
+	for _, r := range m.limiters {
+		select {
+		case <-r.done:
+			giveBack()
+			return false, r.stoppedErr()
+		default:
+		}
+		if r.isDraining() {
+			giveBack()
+			r.overflow("", "draining")
+			return false, ErrStopped
+		}
+		if isShedding() {
+			giveBack()
+			r.limitReached()
+			r.overflow("", "global shed")
+			return false, ErrLimitReached
+		}
+		res := r.tryTake(1)
+		if !res.Granted {
+			giveBack()
+			r.limitReached()
+			r.overflow("", "limit reached")
+			return false, nil
+		}
+		taken = append(taken, res)
+	}
+	return true, nil
+}
+
+// isDraining returns true if one of the limiters is draining (see Shutdown)
+func (m *MultiLimiter) isDraining() bool {
+	for _, r := range m.limiters {
+		if r.isDraining() {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before all the limiters have a slot, and true if it's
+// known. Otherwise the slots seem available but cannot be taken (taken by another call
+// in the meantime, paused limiter, slots held back for a call of several slots) and it
+// returns the poll interval and false.
+func (m *MultiLimiter) delay() (time.Duration, bool) {
+	var wait time.Duration
+	for _, r := range m.limiters {
+		wait = max(wait, r.reserveDelay(1))
+	}
+	if wait <= 0 {
+		return waitSleepDuration, false
+	}
+	return wait, true
+}
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMultiLimiterEnforcesAllTheLimits(t *testing.T) {
+	clock := newFakeClock()
+	perSecond, err := New(context.Background(), time.Second, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer perSecond.Stop()
+	perMinute, err := New(context.Background(), time.Minute, 3, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer perMinute.Stop()
+	m, err := NewMultiLimiter(perSecond, perMinute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := admitted(m, 5); got != 2 {
+		t.Fatalf("%d calls admitted in the first second, want 2", got)
+	}
+	clock.Advance(time.Second)
+	waitRefill(t, perSecond, clock)
+	if got := admitted(m, 5); got != 1 {
+		t.Fatalf("%d calls admitted in the second second, want 1", got)
+	}
+	// the slot of perSecond taken by the denied calls was given back
+	if perSecond.Remaining() != 1 || perMinute.Remaining() != 0 {
+		t.Fatalf("%d and %d slots remaining, want 1 and 0", perSecond.Remaining(), perMinute.Remaining())
+	}
+}
+
+func TestMultiLimiterStopLeavesTheLimiters(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	other, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	m, err := NewMultiLimiter(r, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.IsLimitReached()
+	errs := make(chan error, 1)
+	go func() { errs <- m.WaitContext(context.Background()) }()
+	eventually(t, func() bool {
+		select {
+		case err := <-errs:
+			t.Fatalf("WaitContext() = %v over the limit", err)
+		default:
+		}
+		return r.Stats().Throttled > 0
+	})
+	m.Stop()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrStopped) {
+			t.Fatalf("WaitContext() = %v after Stop, want ErrStopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting call not unblocked by Stop")
+	}
+	if err := m.WaitContext(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Fatalf("WaitContext() = %v after Stop, want ErrStopped", err)
+	}
+	if m.IsLimitReached() {
+		t.Fatal("stopped multi limiter limits")
+	}
+	// the limiters keep working
+	if other.IsLimitReached() || !other.IsLimitReached() {
+		t.Fatal("other limiter not working after Stop of the multi limiter")
+	}
+}
+
+func TestMultiLimiterShortDeadlineWithAPausedLimiter(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	m, err := NewMultiLimiter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Pause()
+	// the delay of a paused limiter is unknown, it's not a reason to give up at once
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := m.WaitContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitContext() = %v, want DeadlineExceeded", err)
+	}
+	time.AfterFunc(time.Millisecond, r.Resume)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.WaitContext(ctx); err != nil {
+		t.Fatalf("WaitContext() = %v after Resume, want nil", err)
+	}
+}
+
+func TestMultiLimiterFailsFastWithAnotherClock(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1, WithClock(newFakeClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	m, err := NewMultiLimiter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.IsLimitReached()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.WaitContext(ctx); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("WaitContext() = %v, want ErrLimitReached without waiting", err)
+	}
+}
+
+func TestMultiLimiterShedsTheCalls(t *testing.T) {
+	defer SetGlobalShed(false)
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	other, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	m, err := NewMultiLimiter(r, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.IsLimitReached()
+	errs := make(chan error, 1)
+	go func() { errs <- m.WaitContext(context.Background()) }()
+	SetGlobalShed(true)
+	if err := <-errs; !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("WaitContext() = %v while shedding, want ErrLimitReached", err)
+	}
+	r.Reset()
+	if !m.IsLimitReached() {
+		t.Fatal("slots granted while shedding")
+	}
+	if err := m.WaitContext(context.Background()); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("WaitContext() = %v while shedding, want ErrLimitReached", err)
+	}
+	SetGlobalShed(false)
+	if m.IsLimitReached() {
+		t.Fatal("still shedding")
+	}
+}
+
+func TestMultiLimiterRefusesTheCallsWhileDraining(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	m, err := NewMultiLimiter(other, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.IsLimitReached()
+	errs := make(chan error, 1)
+	go func() { errs <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- r.Shutdown(context.Background()) }()
+	eventually(t, r.isDraining)
+	if !m.IsLimitReached() {
+		t.Fatal("slots granted while draining")
+	}
+	if err := m.WaitContext(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Fatalf("WaitContext() = %v while draining, want ErrStopped", err)
+	}
+	if other.Remaining() != 2 {
+		t.Fatalf("%d slots remaining in the other limiter, want 2 given back", other.Remaining())
+	}
+	clock.Advance(time.Minute)
+	if err := <-errs; err != nil {
+		t.Fatalf("waiting call = %v, want its slot", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// WriteOpenMetrics writes the metrics of the limiter in the OpenMetrics text format
+func (r *RateLimit) WriteOpenMetrics(w io.Writer) error {
+	return WriteOpenMetrics(w, r)
+}
+
+// WriteOpenMetrics writes the metrics of limiters in the OpenMetrics text format,
+// it only relies on the standard library so it can be served by a minimal HTTP handler.
+// Metric names are prefixed with the name of each limiter (see WithName), so the
+// limiters must have distinct names: it returns ErrInvalidParams without writing
+// anything if two of them would write the same metrics.
+func WriteOpenMetrics(w io.Writer, limiters ...*RateLimit) error {
+	prefixes := make(map[string]bool, len(limiters))
+	for _, r := range limiters {
+		prefix := metricPrefix(r.name)
+		if prefixes[prefix] {
+			return fmt.Errorf("%w: several limiters with the metric prefix %q (see WithName)", ErrInvalidParams, prefix)
+		}
+		prefixes[prefix] = true
+	}
+	mw := &metricsWriter{w: w}
+	for _, r := range limiters {
+		r.writeMetrics(mw)
+	}
+	mw.printf("# EOF\n")
+	return mw.err
+}
+
+func (r *RateLimit) writeMetrics(mw *metricsWriter) {
+	prefix := metricPrefix(r.name)
+	st := r.Stats()
+	mw.counter(prefix+"acquired", "Number of slots acquired.", atomic.LoadUint64(&r.acquired))
+	mw.counter(prefix+"throttled", "Number of calls which reached the limit.", atomic.LoadUint64(&r.throttled))
+	mw.counter(prefix+"refills", "Number of windows refilled.", atomic.LoadUint64(&r.ticks))
+	mw.gauge(prefix+"limit", "Number of slots per window.", float64(st.Limit))
+	mw.gauge(prefix+"in_use", "Number of slots used in the current window.", float64(st.InUse))
+	mw.gauge(prefix+"remaining", "Number of slots available in the current window.", float64(st.Remaining))
+	mw.gauge(prefix+"waiters", "Number of calls waiting for a slot.", float64(r.Waiters()))
+	mw.gauge(prefix+"window_seconds", "Duration of a window in seconds.", st.WindowDuration.Seconds())
+}
+
+// metricPrefix returns the prefix of the metrics of the limiter called name
+func metricPrefix(name string) string {
+	if name == "" {
+		return "ratelimit_"
+	}
+	return "ratelimit_" + strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			return c
+		}
+		return '_'
+	}, name) + "_"
+}
+
+// metricsWriter writes metrics and keeps the first error
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricsWriter) printf(format string, a ...any) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, a...)
+	}
+}
+
+func (mw *metricsWriter) counter(name, help string, v uint64) {
+	mw.printf("# TYPE %s counter\n# HELP %s %s\n%s_total %d\n", name, name, help, name, v)
+}
+
+func (mw *metricsWriter) gauge(name, help string, v float64) {
+	mw.printf("# TYPE %s gauge\n# HELP %s %s\n%s %g\n", name, name, help, name, v)
+}
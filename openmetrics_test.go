@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// parseOpenMetrics checks that text is in the OpenMetrics text format (the subset written
+// by WriteOpenMetrics: metric families without labels) and returns the samples
+func parseOpenMetrics(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	if !strings.HasSuffix(text, "# EOF\n") {
+		t.Fatal("no # EOF at the end")
+	}
+	types := map[string]string{}
+	samples := map[string]float64{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "# EOF\n"), "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		switch {
+		case len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE":
+			name, typ := fields[2], fields[3]
+			if _, ok := types[name]; ok || !metricNameRe.MatchString(name) || (typ != "counter" && typ != "gauge") {
+				t.Fatalf("invalid or duplicated TYPE line %q", line)
+			}
+			types[name] = typ
+		case len(fields) == 4 && fields[0] == "#" && fields[1] == "HELP":
+			if _, ok := types[fields[2]]; !ok {
+				t.Fatalf("HELP of %s before its TYPE", fields[2])
+			}
+		case len(fields) == 2 && metricNameRe.MatchString(fields[0]):
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				t.Fatalf("invalid value in %q: %v", line, err)
+			}
+			samples[fields[0]] = v
+		case line == "":
+		default:
+			t.Fatalf("invalid line %q", line)
+		}
+	}
+	for name, typ := range types {
+		sample := name
+		if typ == "counter" {
+			sample += "_total"
+		}
+		if _, ok := samples[sample]; !ok {
+			t.Fatalf("no sample %s for the %s %s", sample, typ, name)
+		}
+	}
+	return samples
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	api, err := New(context.Background(), time.Hour, 10, WithName("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Stop()
+	db, err := New(context.Background(), time.Second, 5, WithName("db-primary"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Stop()
+	api.AcquireBatch(4)
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, api, db); err != nil {
+		t.Fatal(err)
+	}
+	samples := parseOpenMetrics(t, buf.String())
+	for name, want := range map[string]float64{
+		"ratelimit_api_acquired_total":        4,
+		"ratelimit_api_in_use":                4,
+		"ratelimit_api_remaining":             6,
+		"ratelimit_api_limit":                 10,
+		"ratelimit_api_window_seconds":        3600,
+		"ratelimit_db_primary_limit":          5,
+		"ratelimit_db_primary_acquired_total": 0,
+	} {
+		if got, ok := samples[name]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", name, got, ok, want)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteOpenMetricsReturnsTheWriteError(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.WriteOpenMetrics(failingWriter{}); err == nil {
+		t.Fatal("no error from a failing writer")
+	}
+}
+
+func TestWriteOpenMetricsRejectsDuplicateNames(t *testing.T) {
+	for _, names := range [][]string{{"", ""}, {"api", "api"}, {"my-api", "my.api"}} {
+		var limiters []*RateLimit
+		for _, name := range names {
+			r, err := New(context.Background(), time.Hour, 1, WithName(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			limiters = append(limiters, r)
+		}
+		var buf bytes.Buffer
+		if err := WriteOpenMetrics(&buf, limiters...); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("WriteOpenMetrics() = %v with the names %q, want ErrInvalidParams", err, names)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("metrics written with the names %q", names)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures a RateLimit created by New or NewWithOptions
+type Option func(*RateLimit)
+
+// WithRate sets the rate of the limiter: limit calls per d. It's required by NewWithOptions,
+// New sets it from its parameters.
+func WithRate(d time.Duration, limit int) Option {
+	return func(r *RateLimit) {
+		r.d = d
+		r.limit = limit
+	}
+}
+
+// WithNowFunc replaces the source of the current time (time.Now by default)
+// It's useful to get deterministic values from GetLastCall in tests
+func WithNowFunc(now func() time.Time) Option {
+	return func(r *RateLimit) {
+		if now != nil {
+			r.now = now
+		}
+	}
+}
+
+// WithLogger sets the logger of the limiter. By default, the limiter logs to stdout at
+// the level given by the RATELIMIT_LOGLEVEL environment variable, nothing if it's not set.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *RateLimit) {
+		if l != nil {
+			r.log = l
+		}
+	}
+}
+
+// WithOnEnqueue sets a function called each time a call starts waiting for a slot,
+// depth is the number of waiting calls including this one
+func WithOnEnqueue(fn func(depth int)) Option {
+	return func(r *RateLimit) {
+		r.onEnqueue = fn
+	}
+}
+
+// WithOnDequeue sets a function called each time a waiting call gets a slot or gives up,
+// depth is the number of calls still waiting
+func WithOnDequeue(fn func(depth int)) Option {
+	return func(r *RateLimit) {
+		r.onDequeue = fn
+	}
+}
+
+// WithPenaltyCooldown delays the refill of a saturated window by d: when all the slots
+// of a window have been used, the next window starts d later than usual.
+// The penalty applies once per saturated window.
+// New returns ErrInvalidParams if d < 0.
+func WithPenaltyCooldown(d time.Duration) Option {
+	return func(r *RateLimit) {
+		r.penalty = d
+	}
+}
+
+// WithName names the limiter, the name is used in the metrics
+func WithName(name string) Option {
+	return func(r *RateLimit) {
+		r.name = name
+	}
+}
+
+// WithOverflowLog sets a function called once each time a call is denied, or a waiter
+// gives up because its slot would come too late or its context is done. tag identifies
+// the call (empty if the call is not tagged) and reason explains the denial. It's called
+// without holding any lock.
+func WithOverflowLog(fn func(tag string, reason string)) Option {
+	return func(r *RateLimit) {
+		r.overflowLog = fn
+	}
+}
+
+// WithSpinBeforePark makes the waiting calls try to get a slot spins more times,
+// yielding the processor between the tries, before waiting. It can reduce the latency
+// when a slot is about to be freed at the cost of CPU. No spin by default.
+func WithSpinBeforePark(spins int) Option {
+	return func(r *RateLimit) {
+		r.spins = spins
+	}
+}
+
+// WithOnWindowEnd sets a function called by the background goroutine at the end of
+// each window with the number of slots granted during the window. It's called without
+// holding any lock, a panic of fn is recovered and logged. A slow fn delays the next refill.
+func WithOnWindowEnd(fn func(count int, windowStart, windowEnd time.Time)) Option {
+	return func(r *RateLimit) {
+		r.onWindowEnd = fn
+	}
+}
+
+// WithOnReset sets a function called by the background goroutine each time the window
+// is refilled, with the number of slots freed (those of the fixed window, 0 with the
+// other algorithms). It's called without holding any lock, after the window end callback,
+// a panic of fn is recovered and logged. A slow fn delays the next refill.
+func WithOnReset(fn func(drained int)) Option {
+	return func(r *RateLimit) {
+		r.onReset = fn
+	}
+}
+
+// WithOnBlock sets a function called when a call has to wait for a slot, once per
+// window for the first one, e.g. to alert on saturation. The calls granted a slot at
+// once or denied without waiting do not call it. fn is called by the waiting call,
+// without holding any lock.
+func WithOnBlock(fn func()) Option {
+	return func(r *RateLimit) {
+		r.onBlock = fn
+	}
+}
+
+// WithPollInterval sets the delay between two attempts of a waiting call to get a slot
+// when the next slot cannot be predicted, i.e. with a Store shared by several processes
+// (10ms by default). Otherwise the waiting calls are woken up when a slot is available.
+// A shorter interval reduces the time a call waits at the cost of CPU and store queries.
+// New returns ErrInvalidParams if d <= 0.
+func WithPollInterval(d time.Duration) Option {
+	return func(r *RateLimit) {
+		r.pollInterval = d
+	}
+}
+
+// WithJitter spreads the waiting calls over a random delay up to maxJitter once their
+// slot is available (e.g. after a refill), instead of letting them all hit the protected
+// resource at the same time.
+// New returns ErrInvalidParams if maxJitter < 0.
+func WithJitter(maxJitter time.Duration) Option {
+	return func(r *RateLimit) {
+		r.jitter = maxJitter
+	}
+}
+
+// WithTTL stops the limiter once d has elapsed since New, as Stop does: the waiting
+// calls return ErrStopped. It's useful for limits tied to a temporary token.
+func WithTTL(d time.Duration) Option {
+	return func(r *RateLimit) {
+		r.ttl = d
+	}
+}
+
+// WithWindowAnchor aligns the windows on t: the refills happen at t plus a multiple of
+// the duration instead of every duration after New. E.g. with the start of a day as
+// anchor and a duration of one minute, the windows start at the top of each minute.
+func WithWindowAnchor(t time.Time) Option {
+	return func(r *RateLimit) {
+		r.anchor = t
+	}
+}
@@ -0,0 +1,464 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func ExampleWithNowFunc() {
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, err := New(context.Background(), time.Second, 10, WithNowFunc(func() time.Time { return fixed }))
+	if err != nil {
+		panic(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	fmt.Println(r.GetLastCall())
+	// Output: 2024-01-02 03:04:05 +0000 UTC
+}
+
+func TestGetLastCallUsesNowFunc(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r, err := New(context.Background(), time.Hour, 10, WithNowFunc(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		r.WaitIfLimitReached()
+		if got := r.GetLastCall(); !got.Equal(now) {
+			t.Fatalf("GetLastCall() = %v, want %v", got, now)
+		}
+	}
+}
+
+func TestOverflowLogOncePerDenial(t *testing.T) {
+	var reasons []string
+	r, err := New(context.Background(), time.Hour, 1, WithOverflowLog(func(tag, reason string) {
+		reasons = append(reasons, reason)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	other, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	multi, err := NewMultiLimiter(other, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.IsLimitReached() {
+		t.Fatal("first call denied")
+	}
+	if len(reasons) != 0 {
+		t.Fatalf("overflow log called for a granted call: %v", reasons)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	for _, tc := range []struct {
+		name   string
+		deny   func()
+		reason string
+	}{
+		{"IsLimitReached", func() { r.IsLimitReached() }, "limit reached"},
+		{"TryAcquireN", func() { r.TryAcquireN(1) }, "limit reached"},
+		{"TryAcquireInfo", func() { r.TryAcquireInfo() }, "limit reached"},
+		{"AcquireBatch", func() { r.AcquireBatch(1) }, "limit reached"},
+		{"AcquireRemaining", func() { r.AcquireRemaining() }, "limit reached"},
+		{"AcquireWithin", func() { _ = r.AcquireWithin(context.Background(), 1) }, "max attempts reached"},
+		{"WaitContext deadline", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = r.WaitContext(ctx)
+		}, "deadline before next slot"},
+		{"WaitContext cancelled", func() {
+			go func() {
+				for r.Waiters() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}()
+			_ = r.WaitContext(cancelled)
+		}, "context done"},
+		{"MultiLimiter", func() { multi.IsLimitReached() }, "limit reached"},
+	} {
+		reasons = nil
+		tc.deny()
+		if len(reasons) != 1 || reasons[0] != tc.reason {
+			t.Errorf("%s: overflow log called with %q, want once with %q", tc.name, reasons, tc.reason)
+		}
+	}
+}
+
+func TestSpinBeforeParkNeverExceedsTheLimit(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 5, WithSpinBeforePark(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r.TryAcquire(50 * time.Millisecond) {
+				granted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := granted.Load(); got != 5 {
+		t.Fatalf("%d slots granted, want 5", got)
+	}
+}
+
+func BenchmarkSpinBeforePark(b *testing.B) {
+	for _, spins := range []int{0, 100} {
+		b.Run(strconv.Itoa(spins), func(b *testing.B) {
+			r, err := New(context.Background(), MinDuration, 1, WithSpinBeforePark(spins))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Stop()
+			for b.Loop() {
+				r.WaitIfLimitReached()
+			}
+		})
+	}
+}
+
+func TestOnWindowEndReportsTheCount(t *testing.T) {
+	type window struct {
+		count      int
+		start, end time.Time
+	}
+	windows := make(chan window, 10)
+	clock := newFakeClock()
+	start := clock.Now()
+	r, err := New(context.Background(), time.Minute, 5, WithClock(clock), WithOnWindowEnd(func(count int, windowStart, windowEnd time.Time) {
+		windows <- window{count, windowStart, windowEnd}
+		if count == 1 {
+			panic("callback failure")
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, want := range []int{3, 1, 0, 5} {
+		for range want {
+			r.IsLimitReached()
+		}
+		if want == 5 && !r.IsLimitReached() {
+			t.Fatal("slot granted beyond the limit")
+		}
+		clock.Advance(time.Minute)
+		select {
+		case w := <-windows:
+			if w.count != want || !w.start.Equal(start) || !w.end.Equal(start.Add(time.Minute)) {
+				t.Fatalf("window end = %+v, want count %d from %v", w, want, start)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("window end callback not called")
+		}
+		start = start.Add(time.Minute)
+		eventually(t, func() bool { return r.Remaining() == 5 })
+	}
+}
+
+func TestPollIntervalReducesTheOvershoot(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		opts     []Option
+	}{
+		{time.Millisecond, []Option{WithPollInterval(time.Millisecond)}},
+		{waitSleepDuration, nil},
+	} {
+		clock := newFakeClock()
+		store := &memStore{taken: 1}
+		r, err := New(context.Background(), time.Hour, 1, append(tc.opts, WithClock(clock), WithStore(store))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- r.Wait() }()
+		eventually(t, func() bool { return clock.Timers() == 1 })
+		// the slot is freed by another process, the call only sees it at its next poll
+		store.mu.Lock()
+		store.taken = 0
+		store.mu.Unlock()
+		var overshoot time.Duration
+		for granted := false; !granted; {
+			clock.Advance(time.Millisecond)
+			overshoot += time.Millisecond
+			// the call is either granted or waiting for its next poll
+			eventually(t, func() bool {
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatal(err)
+					}
+					granted = true
+				default:
+				}
+				return granted || clock.Timers() == 1
+			})
+		}
+		if overshoot != tc.interval {
+			t.Errorf("granted %v after the slot was freed, want %v", overshoot, tc.interval)
+		}
+		r.Stop()
+	}
+}
+
+func TestPollIntervalInvalid(t *testing.T) {
+	if _, err := New(context.Background(), time.Second, 1, WithPollInterval(0)); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("New() error = %v, want ErrInvalidParams", err)
+	}
+}
+
+func TestTTLUnblocksTheWaiters(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Hour, 1, WithClock(clock), WithTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	done := make(chan error, 1)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	clock.Advance(59 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("the limiter stopped before its TTL: %v", err)
+	default:
+	}
+	clock.Advance(time.Second)
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStopped) {
+			t.Fatalf("Wait() = %v, want ErrStopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiter was not unblocked at the TTL")
+	}
+}
+
+func TestWindowAnchorAlignsTheRefills(t *testing.T) {
+	clock := newFakeClock()
+	anchor := clock.Now()
+	clock.Advance(25 * time.Second)
+	ends := make(chan time.Time, 10)
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithWindowAnchor(anchor.Add(-time.Hour)), WithOnWindowEnd(func(_ int, _, windowEnd time.Time) {
+		ends <- windowEnd
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.TimeUntilReset(); got != 35*time.Second {
+		t.Fatalf("TimeUntilReset() = %v, want 35s to the top of the minute", got)
+	}
+	for i := 1; i <= 3; i++ {
+		if i == 1 {
+			clock.Advance(35 * time.Second)
+		} else {
+			clock.Advance(time.Minute)
+		}
+		select {
+		case end := <-ends:
+			if want := anchor.Add(time.Duration(i) * time.Minute); !end.Equal(want) {
+				t.Fatalf("window ended at %v, want %v", end, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no refill")
+		}
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	clock := newFakeClock()
+	var logs syncBuffer
+	r, err := NewWithOptions(context.Background(), WithRate(time.Minute, 10), WithAlgorithm(TokenBucket), WithBurst(20), WithClock(clock), WithLogger(debugLogger(&logs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if st := r.Stats(); st.Limit != 10 || st.WindowDuration != time.Minute || r.Remaining() != 20 {
+		t.Fatalf("Stats() = %+v, %d remaining, want 10 per minute with a burst of 20", st, r.Remaining())
+	}
+	if !r.GetLastCall().Equal(clock.Now()) || logs.count("Start backgroundRoutine") != 1 {
+		t.Fatal("the clock or the logger given were not used")
+	}
+	for _, opts := range [][]Option{nil, {WithRate(0, 10)}, {WithRate(time.Second, 0)}, {WithLogger(debugLogger(&logs))}} {
+		if _, err := NewWithOptions(context.Background(), opts...); !errors.Is(err, ErrInvalidParams) {
+			t.Fatalf("NewWithOptions() = %v without a valid rate, want ErrInvalidParams", err)
+		}
+	}
+}
+
+// parkedBefore returns true if each waiting call of r waits for a timer of clock due
+// before deadline
+func parkedBefore(r *RateLimit, clock *fakeClock, deadline time.Time) bool {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	n := 0
+	for _, t := range clock.timers {
+		if t.period == 0 {
+			if t.at.After(deadline) {
+				return false
+			}
+			n++
+		}
+	}
+	return n == r.Waiters()
+}
+
+func TestJitterSpreadsTheWokenCalls(t *testing.T) {
+	clock := newFakeClock()
+	const n = 20
+	r, err := New(context.Background(), time.Minute, n, WithClock(clock), WithJitter(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireRemaining()
+	for range n {
+		go r.WaitIfLimitReached()
+	}
+	eventually(t, func() bool {
+		return r.Waiters() == n && parkedBefore(r, clock, clock.Now().Add(time.Minute+time.Second))
+	})
+	// the calls are woken at once by the refill and wait for their jitter
+	r.ForceRefill()
+	end := clock.Now().Add(time.Second)
+	eventually(t, func() bool { return parkedBefore(r, clock, end) })
+	steps := 0
+	for r.Waiters() > 0 {
+		if clock.Now().After(end) {
+			t.Fatalf("%d calls still waiting after the jitter", r.Waiters())
+		}
+		before := r.Waiters()
+		clock.Advance(100 * time.Millisecond)
+		eventually(t, func() bool { return parkedBefore(r, clock, end) })
+		if r.Waiters() < before {
+			steps++
+		}
+	}
+	if steps < 3 {
+		t.Fatalf("calls granted in %d steps of 100ms, want them spread over the jitter", steps)
+	}
+}
+
+func TestJitterIsNotSkippedAtTheRefill(t *testing.T) {
+	clock := newFakeClock()
+	const n = 20
+	r, err := New(context.Background(), time.Minute, n, WithClock(clock), WithJitter(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireRemaining()
+	for range n {
+		go r.WaitIfLimitReached()
+	}
+	eventually(t, func() bool {
+		return r.Waiters() == n && parkedBefore(r, clock, clock.Now().Add(time.Minute+time.Second))
+	})
+	// the timers of the calls are not due with the refill
+	clock.Advance(time.Minute)
+	waitRefill(t, r, clock)
+	time.Sleep(10 * time.Millisecond)
+	if granted := n - r.Waiters(); granted > n/2 {
+		t.Fatalf("%d calls granted at the refill, want them spread over the jitter", granted)
+	}
+	clock.Advance(time.Second)
+	eventually(t, func() bool { return r.Waiters() == 0 })
+}
+
+func TestOnResetCountsTheWindows(t *testing.T) {
+	clock := newFakeClock()
+	resets := make(chan int, 10)
+	var r *RateLimit
+	r, err := New(context.Background(), time.Minute, 5, WithClock(clock), WithOnReset(func(drained int) {
+		// the limiter can be called back, no lock is held
+		_ = r.Remaining()
+		resets <- drained
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, used := range []int{2, 0, 5} {
+		for range used {
+			r.IsLimitReached()
+		}
+		clock.Advance(time.Minute)
+		select {
+		case drained := <-resets:
+			if drained != used {
+				t.Fatalf("reset with %d slots drained, want %d", drained, used)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("reset callback not called")
+		}
+	}
+	if len(resets) != 0 {
+		t.Fatalf("%d extra resets", len(resets))
+	}
+}
+
+func TestOnBlockOncePerWindow(t *testing.T) {
+	clock := newFakeClock()
+	var blocks atomic.Int32
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithPollInterval(time.Millisecond), WithOnBlock(func() {
+		blocks.Add(1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	// granted at once, not blocked
+	r.WaitIfLimitReached()
+	if blocks.Load() != 0 {
+		t.Fatal("block callback called for an immediate grant")
+	}
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() { errs <- r.Wait() }()
+	}
+	eventually(t, func() bool { return r.Waiters() == 3 })
+	if got := blocks.Load(); got != 1 {
+		t.Fatalf("block callback called %d times in the first window, want 1", got)
+	}
+	// the calls still waiting in the next window are not blocked again
+	clock.Advance(time.Minute)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return r.Waiters() == 2 })
+	if got := blocks.Load(); got != 1 {
+		t.Fatalf("block callback called %d times, want 1: not once per retry", got)
+	}
+	// the first call blocked in the new window
+	go func() { errs <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 3 })
+	if got := blocks.Load(); got != 2 {
+		t.Fatalf("block callback called %d times after 2 windows, want 2", got)
+	}
+	r.Stop()
+	for range 3 {
+		<-errs
+	}
+}
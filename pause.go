@@ -0,0 +1,63 @@
+package ratelimit
+
+import "weak"
+
+// Pause makes the limiter deny all the calls until Resume: IsLimitReached returns true
+// and the waiting calls keep waiting (until their context is done)
+func (r *RateLimit) Pause() {
+	r.setPaused(true)
+}
+
+// Resume ends a Pause
+func (r *RateLimit) Resume() {
+	r.setPaused(false)
+}
+
+// IsPaused returns true if the limiter is paused
+func (r *RateLimit) IsPaused() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused
+}
+
+func (r *RateLimit) setPaused(paused bool) {
+	r.mu.Lock()
+	changed := r.paused != paused
+	r.paused = paused
+	if changed && !paused {
+		r.wakeLocked()
+	}
+	r.mu.Unlock()
+	if changed {
+		r.log.Debug("Paused", "paused", paused)
+		r.record(EventReconfigure)
+	}
+}
+
+// WithPauseSignal pauses the limiter when true is received from signal and resumes
+// it when false is received, e.g. during maintenance windows. The signal only pauses
+// the limiter, it does not stop it: closing signal just stops watching it.
+func WithPauseSignal(signal <-chan bool) Option {
+	return func(r *RateLimit) {
+		r.pauseSignal = signal
+	}
+}
+
+// watchPauseSignal launches a goroutine applying the values received from the pause signal
+func (r *RateLimit) watchPauseSignal() {
+	wr, signal, done := weak.Make(r), r.pauseSignal, r.done
+	go func() {
+		for {
+			select {
+			case paused, ok := <-signal:
+				r := wr.Value()
+				if !ok || r == nil {
+					return
+				}
+				r.setPaused(paused)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseSignalCycle(t *testing.T) {
+	signal := make(chan bool)
+	r, err := New(context.Background(), time.Hour, 10, WithPauseSignal(signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	signal <- true
+	eventually(t, r.IsPaused)
+	if !r.IsLimitReached() {
+		t.Fatal("slot granted while paused")
+	}
+	// a paused waiter respects its own context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.WaitContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitContext() = %v while paused, want context.DeadlineExceeded", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	signal <- false
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiter was not resumed")
+	}
+	if r.IsPaused() || r.IsLimitReached() {
+		t.Fatal("the limiter is still paused")
+	}
+	// closing the signal stops watching it, the limiter keeps working
+	close(signal)
+	if r.IsLimitReached() {
+		t.Fatal("limit reached after closing the signal")
+	}
+}
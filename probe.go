@@ -0,0 +1,51 @@
+package ratelimit
+
+import "context"
+
+// WithProbeBudget limits the number of probes granted by AcquireProbe to n per window.
+// Probes are not limited by default.
+func WithProbeBudget(n int) Option {
+	return func(r *RateLimit) {
+		r.probeBudget = n
+	}
+}
+
+// AcquireProbe grants a health probe (e.g. of a half-open circuit breaker) without
+// consuming the slots of the window, so that probes get through even when the limiter
+// is saturated. With WithProbeBudget, it waits for the next window once the budget
+// of the current one is used, until ctx is done. It returns ErrLimitReached while the
+// calls are shed (see SetGlobalShed).
+func (r *RateLimit) AcquireProbe(ctx context.Context) error {
+	for {
+		// the signals are taken before trying so that a refill or a shed cannot be missed
+		refilled, shed := r.refillSignal(), globalShedSignal()
+		if r.takeProbe() {
+			return nil
+		}
+		select {
+		case <-shed:
+			r.overflow("", "global shed")
+			return ErrLimitReached
+		case <-refilled:
+		case <-ctx.Done():
+			r.overflow("", "context done")
+			return ctx.Err()
+		case <-r.done:
+			return r.stoppedErr()
+		}
+	}
+}
+
+// takeProbe consumes a probe of the budget if one is available
+func (r *RateLimit) takeProbe() bool {
+	if isShedding() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.probeBudget > 0 && r.probesUsed >= r.probeBudget {
+		return false
+	}
+	r.probesUsed++
+	return true
+}
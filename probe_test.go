@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProbesGetThroughASaturatedWindow(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	for range 5 {
+		if err := r.AcquireProbe(context.Background()); err != nil {
+			t.Fatalf("AcquireProbe() = %v with the window full", err)
+		}
+	}
+	if !r.IsSaturated() || r.Remaining() != 0 {
+		t.Fatal("the probes changed the window")
+	}
+}
+
+func TestProbeBudget(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithProbeBudget(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	for range 2 {
+		if err := r.AcquireProbe(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.AcquireProbe(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AcquireProbe() = %v beyond the budget, want context.Canceled", err)
+	}
+	// the budget is restored by the refill
+	done := make(chan error, 1)
+	go func() { done <- r.AcquireProbe(context.Background()) }()
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
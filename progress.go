@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// WaitWithProgress waits for a slot like AcquireContext and calls onWait every interval
+// while waiting, with the time elapsed since the call, e.g. to tell an operator that the
+// call is throttled. onWait is not called anymore once WaitWithProgress has returned.
+// It returns ErrInvalidParams if interval <= 0.
+func (r *RateLimit) WaitWithProgress(ctx context.Context, interval time.Duration, onWait func(elapsed time.Duration)) error {
+	if interval <= 0 {
+		return ErrInvalidParams
+	}
+	r.setLastCall()
+	start := r.now()
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := r.clock.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+				select {
+				case <-stop:
+					// the slot was granted meanwhile
+					return
+				default:
+				}
+				onWait(nonNegative(r.now().Sub(start)))
+			case <-stop:
+				return
+			}
+		}
+	}()
+	_, err := r.acquire(ctx)
+	close(stop)
+	<-stopped
+	return err
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitWithProgressCadence(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Hour, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	progress := make(chan time.Duration, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.WaitWithProgress(context.Background(), 10*time.Second, func(elapsed time.Duration) {
+			progress <- elapsed
+		})
+	}()
+	// the refill ticker, the progress ticker and the timer of the waiting call
+	eventually(t, func() bool {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return len(clock.timers) == 3 && r.Waiters() == 1
+	})
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+		clock.Advance(10 * time.Second)
+		select {
+		case elapsed := <-progress:
+			if elapsed != want {
+				t.Fatalf("onWait(%v), want %v", elapsed, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("onWait not called")
+		}
+	}
+	r.ForceRefill()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	select {
+	case elapsed := <-progress:
+		t.Fatalf("onWait(%v) called after the slot was granted", elapsed)
+	default:
+	}
+}
+
+func TestWaitWithProgressCancelled(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	calls := 0
+	err = r.WaitWithProgress(ctx, 10*time.Millisecond, func(time.Duration) { calls++ })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitWithProgress() = %v, want context.Canceled", err)
+	}
+	after := calls
+	time.Sleep(30 * time.Millisecond)
+	if after == 0 || calls != after {
+		t.Fatalf("onWait called %d times while waiting, %d after the cancellation", after, calls-after)
+	}
+}
+
+func TestWaitWithProgressInvalidInterval(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.WaitWithProgress(context.Background(), 0, func(time.Duration) {}); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("WaitWithProgress() = %v, want ErrInvalidParams", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Package prometheus exposes the metrics of a ratelimit.RateLimit to Prometheus.
+// It's a separate module so that the ratelimit package does not depend on client_golang.
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sgaunet/ratelimit"
+)
+
+// Collector is a prometheus.Collector reading the Stats of a limiter at each scrape
+type Collector struct {
+	r           *ratelimit.RateLimit
+	utilization *prometheus.Desc
+	remaining   *prometheus.Desc
+	throttled   *prometheus.Desc
+	acquired    *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector of the metrics of r, labelled with limiter="name"
+// so that several limiters can be registered:
+//
+//	prometheus.MustRegister(ratelimitprom.NewCollector(r, "github_api"))
+func NewCollector(r *ratelimit.RateLimit, name string) *Collector {
+	labels := prometheus.Labels{"limiter": name}
+	return &Collector{
+		r: r,
+		utilization: prometheus.NewDesc("ratelimit_utilization",
+			"Fraction of the slots of the current window in use.", nil, labels),
+		remaining: prometheus.NewDesc("ratelimit_remaining",
+			"Number of slots available in the current window.", nil, labels),
+		throttled: prometheus.NewDesc("ratelimit_throttled_total",
+			"Number of calls which reached the limit.", nil, labels),
+		acquired: prometheus.NewDesc("ratelimit_acquired_total",
+			"Number of slots acquired.", nil, labels),
+	}
+}
+
+// Describe sends the descriptors of the metrics
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.utilization
+	ch <- c.remaining
+	ch <- c.throttled
+	ch <- c.acquired
+}
+
+// Collect sends the metrics read from one snapshot of the limiter
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	st := c.r.Stats()
+	var utilization float64
+	if st.Limit > 0 {
+		utilization = float64(st.InUse) / float64(st.Limit)
+	}
+	ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, utilization)
+	ch <- prometheus.MustNewConstMetric(c.remaining, prometheus.GaugeValue, float64(st.Remaining))
+	ch <- prometheus.MustNewConstMetric(c.throttled, prometheus.CounterValue, float64(st.Throttled))
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.CounterValue, float64(st.Acquired))
+}
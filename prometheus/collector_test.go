@@ -0,0 +1,51 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sgaunet/ratelimit"
+)
+
+func TestCollectorRegistered(t *testing.T) {
+	r, err := ratelimit.New(context.Background(), time.Hour, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	r.IsLimitReached()
+	r.IsLimitReached()
+	r.IsLimitReached()
+	r.IsLimitReached() // throttled
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(NewCollector(r, "api")); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"ratelimit_utilization":     1,
+		"ratelimit_remaining":       0,
+		"ratelimit_throttled_total": 1,
+		"ratelimit_acquired_total":  4,
+	}
+	if len(families) != len(want) {
+		t.Fatalf("%d metrics gathered, want %d", len(families), len(want))
+	}
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		if len(m.GetLabel()) != 1 || m.GetLabel()[0].GetName() != "limiter" || m.GetLabel()[0].GetValue() != "api" {
+			t.Errorf("%s: labels %v, want limiter=api", mf.GetName(), m.GetLabel())
+		}
+		got := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		if v, ok := want[mf.GetName()]; !ok || got != v {
+			t.Errorf("%s = %v, want %v", mf.GetName(), got, v)
+		}
+	}
+}
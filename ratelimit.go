@@ -3,154 +3,1034 @@ package ratelimit
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/bits"
+	"math/rand/v2"
 	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/sirupsen/logrus"
+	"weak"
 )
 
+// ErrInvalidParams is returned when the duration or the limit is <= 0
+var ErrInvalidParams = errors.New("ratelimit: duration or limit cannot be <= 0")
+
+// ErrStopped is returned when the limiter has been stopped
+var ErrStopped = errors.New("ratelimit: stopped")
+
+// ErrLimitReached is returned when a slot cannot be obtained in time
+var ErrLimitReached = errors.New("ratelimit: limit reached")
+
+// ErrExceedsLimit is returned when more slots are requested at once than a window can hold
+var ErrExceedsLimit = errors.New("ratelimit: more slots requested than the limit")
+
 type RateLimit struct {
-	d        time.Duration
-	limit    int
-	ch       chan struct{}
-	ctx      context.Context
-	t        *time.Ticker
-	lastCall time.Time
-	log      *logrus.Logger
+	// counters first to be 64-bit aligned for atomic operations,
+	// the uint64 ones wrap around on overflow (centuries at millions of calls per second)
+	waiters   int64
+	acquired  uint64
+	throttled uint64
+	ticks     uint64
+	// immediate and blocked acquisitions of the current and previous windows
+	immediate, prevImmediate uint64
+	blocked, prevBlocked     uint64
+	// waiting acquisitions since New, and those which could not get a slot at once
+	attempts, blockedTotal uint64
+
+	d     time.Duration
+	limit int
+	ch    chan struct{}
+	ctx   context.Context
+	// done is closed by teardown only, under stopOnce, whatever stops the limiter
+	// (Stop, Shutdown, cancelled context, TTL, finalizer)
+	done chan struct{}
+	// stopCtx is derived from ctx and cancelled by teardown, so that the calls to the
+	// store in progress are aborted by Stop
+	stopCtx    context.Context
+	cancelFunc context.CancelFunc
+	// exited and ctxExited are closed when the background goroutine and the one
+	// watching the context end
+	exited    chan struct{}
+	ctxExited chan struct{}
+	stopOnce  sync.Once
+	// draining is closed by Shutdown, the new calls are refused
+	draining  chan struct{}
+	drainOnce sync.Once
+	// drained is closed once no call is waiting while draining
+	drained     chan struct{}
+	drainedOnce sync.Once
+	t           Ticker
+	lastCall    time.Time
+	log         *slog.Logger
+	now         func() time.Time
+	clock       Clock
+	mu          sync.RWMutex
+	limitLog    logGate
+	// windowStart is the time of the last refill
+	windowStart   time.Time
+	store         Store
+	storeFallback StoreFallback
+	storeLog      logGate
+	onEnqueue     func(depth int)
+	onDequeue     func(depth int)
+	penalty       time.Duration
+	name          string
+	overflowLog   func(tag string, reason string)
+	spins         int
+	lastGrant     time.Time
+	gaps          gapReservoir
+	windowCount   int
+	// generation is incremented when all the slots are freed (refill of a fixed window, Reset)
+	generation  uint64
+	recent      recentWindows
+	onWindowEnd func(count int, windowStart, windowEnd time.Time)
+	onReset     func(drained int)
+	onBlock     func()
+	// blockNotified is set once onBlock has been called during the current window
+	blockNotified bool
+	leakFinalizer bool
+	pollInterval  time.Duration
+	jitter        time.Duration
+	ttl           time.Duration
+	// refilled is closed (and replaced) each time the window is refilled
+	refilled chan struct{}
+	events   *eventRing
+	paused   bool
+	// pauseSignal pauses (true) and resumes (false) the limiter
+	pauseSignal <-chan bool
+	probeBudget int
+	probesUsed  int
+	// anchor is a time of refill, the windows are aligned on it
+	anchor time.Time
+	// shortWindow is set when the ticker fires after a delay other than d (alignment on
+	// the anchor, SetDuration), its period is reset to d at the next refill
+	shortWindow bool
+	algorithm   Algorithm
+	gcraBurst   time.Duration
+	// tat is the theoretical arrival time of the next call with GCRA
+	tat time.Time
+	// tokens is the number of tokens of the bucket at tokensAt with TokenBucket,
+	// a zero tokensAt means a full bucket
+	tokens   float64
+	tokensAt time.Time
+	// burst is the capacity of the bucket with TokenBucket if burstSet, limit otherwise
+	burst    int
+	burstSet bool
+	// callLog holds the time of the last calls, oldest first, with SlidingWindowLog
+	callLog       []time.Time
+	strict        bool
+	debugControls bool
+	// tiers are the windows of a tiered limiter besides the main one
+	tiers []*tier
+	// claim holds back the slots for a waiting call of several slots, see claimLocked
+	claim *claim
 }
 
 // New returns a Ratelimit instance and initialize it
-func New(ctx context.Context, d time.Duration, limit int) (*RateLimit, error) {
-	if limit <= 0 || d <= 0 {
-		return nil, errors.New("ratelimit: duration or limit cannot be <= 0")
-	}
+// It returns ErrInvalidParams if d or limit is <= 0, and an error wrapping the error
+// of ctx if ctx is already done (the limiter would never limit anything).
+func New(ctx context.Context, d time.Duration, limit int, opts ...Option) (*RateLimit, error) {
+	return NewWithOptions(ctx, append([]Option{WithRate(d, limit)}, opts...)...)
+}
 
+// NewWithOptions returns a RateLimit configured by opts only, the rate must be given
+// by WithRate. It returns ErrInvalidParams if there is no valid rate, and an error
+// wrapping the error of ctx if ctx is already done.
+func NewWithOptions(ctx context.Context, opts ...Option) (*RateLimit, error) {
 	r := RateLimit{
-		d:        d,
-		limit:    limit,
-		ch:       make(chan struct{}, limit),
-		ctx:      ctx,
-		log:      initLog(os.Getenv("RATELIMIT_LOGLEVEL")),
-		lastCall: time.Now(),
+		done:         make(chan struct{}),
+		exited:       make(chan struct{}),
+		ctxExited:    make(chan struct{}),
+		draining:     make(chan struct{}),
+		drained:      make(chan struct{}),
+		ctx:          ctx,
+		log:          initLog(os.Getenv("RATELIMIT_LOGLEVEL")),
+		now:          time.Now,
+		clock:        realClock{},
+		pollInterval: waitSleepDuration,
+		refilled:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	if r.limit <= 0 || r.d <= 0 || r.algorithm < FixedWindow || r.algorithm > LeakyBucket {
+		return nil, ErrInvalidParams
+	}
+	if r.algorithm == LeakyBucket {
+		r.gcraBurst = 0
+	}
+	if r.burstSet && (r.burst < 1 || r.algorithm != TokenBucket) {
+		return nil, ErrInvalidParams
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("ratelimit: context already done: %w", err)
+	}
+	if r.d < MinDuration {
+		d, limit := scaleToMinDuration(r.d, r.limit)
+		r.log.Warn("Duration below MinDuration, the limit is scaled", "duration", r.d, "min", MinDuration, "scaled_limit", limit, "scaled_duration", d)
+		r.d, r.limit = d, limit
 	}
+	r.ch = make(chan struct{}, r.limit)
+	r.limitLog.window = r.d
+	r.storeLog.window = r.d
+	if r.pollInterval <= 0 || r.jitter < 0 || r.penalty < 0 {
+		return nil, ErrInvalidParams
+	}
+	if err := r.checkRate(r.limit, r.d); err != nil {
+		return nil, err
+	}
+	r.lastCall = r.now()
+	r.windowStart = r.lastCall
+	if !r.anchor.IsZero() {
+		r.windowStart = anchoredWindowStart(r.anchor, r.lastCall, r.d)
+	}
+	r.stopCtx, r.cancelFunc = context.WithCancel(ctx)
 	r.backgroundRoutine()
 	r.handleCtx()
+	if r.pauseSignal != nil {
+		r.watchPauseSignal()
+	}
+	if r.ttl > 0 {
+		wr := weak.Make(&r)
+		r.clock.AfterFunc(r.ttl, func() {
+			if r := wr.Value(); r != nil {
+				r.log.Debug("TTL expired")
+				r.teardown()
+			}
+		})
+	}
+	if r.leakFinalizer {
+		runtime.SetFinalizer(&r, (*RateLimit).finalize)
+	}
 	return &r, nil
 }
 
-// backgroundRoutine launches a goroutine to empty the channel every r.d duration
+// MinDuration is the shortest window supported: a shorter duration would make the
+// background goroutine refill the window so often that it would use a whole CPU.
+// New raises a shorter duration to MinDuration and scales the limit to keep the same rate.
+const MinDuration = time.Millisecond
+
+// scaleToMinDuration returns MinDuration and the limit giving the same rate as limit per d,
+// rounded up so that the rate is not lowered
+func scaleToMinDuration(d time.Duration, limit int) (time.Duration, int) {
+	hi, lo := bits.Mul64(uint64(limit), uint64(MinDuration))
+	if hi >= uint64(d) {
+		return MinDuration, math.MaxInt
+	}
+	q, rem := bits.Div64(hi, lo, uint64(d))
+	if q >= math.MaxInt {
+		return MinDuration, math.MaxInt
+	}
+	if rem > 0 {
+		q++
+	}
+	return MinDuration, int(q)
+}
+
+// backgroundRoutine launches a goroutine to empty the channel every r.d duration.
+// The goroutine only keeps a weak reference to r so that a limiter which is not
+// referenced anymore can be garbage collected (see WithLeakFinalizer).
 func (r *RateLimit) backgroundRoutine() {
-	r.log.Debugln("Start backgroundRoutine")
+	r.log.Debug("Start backgroundRoutine")
+	first := r.d
+	if !r.anchor.IsZero() {
+		// the first window is shorter to align the refills on the anchor
+		if first = r.windowStart.Add(r.d).Sub(r.now()); first <= 0 {
+			first = r.d
+		}
+	}
+	r.shortWindow = first != r.d
+	r.t = r.clock.NewTicker(first)
+	wr, t, done, exited, log := weak.Make(r), r.t, r.done, r.exited, r.log
 	go func() {
-		r.t = time.NewTicker(r.d)
+		defer close(exited)
 	loop:
 		for {
 			select {
-			case <-r.t.C:
-				r.emptyChan()
-			case <-r.ctx.Done():
+			case <-t.C():
+				r := wr.Value()
+				if r == nil || !r.tick() {
+					break loop
+				}
+			case <-done:
 				break loop
 			}
 		}
-		r.log.Debugln("Stop backgroundRoutine")
+		t.Stop()
+		log.Debug("Stop backgroundRoutine")
 	}()
 }
 
+// tick refills the window, after the penalty cooldown if the window is saturated.
+// It returns false if the limiter has been stopped in the meantime.
+func (r *RateLimit) tick() bool {
+	if r.penalty > 0 && r.isFull() {
+		r.log.Debug("Window saturated, penalty cooldown")
+		select {
+		case <-r.clock.After(r.penalty):
+		case <-r.done:
+			return false
+		}
+		// the next window starts after the penalty
+		r.mu.Lock()
+		r.t.Reset(r.d)
+		r.shortWindow = false
+		r.mu.Unlock()
+	} else {
+		r.mu.Lock()
+		if r.shortWindow {
+			r.t.Reset(r.d)
+			r.shortWindow = false
+		}
+		r.mu.Unlock()
+	}
+	r.refill()
+	return true
+}
+
+// handleCtx tears the limiter down when the context is done, so that calling Stop is not needed
 func (r *RateLimit) handleCtx() {
+	wr, ctx, done, exited, log := weak.Make(r), r.ctx, r.done, r.ctxExited, r.log
 	go func() {
-		<-r.ctx.Done()
-		r.log.Debugln("Stop Ticker")
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			if r := wr.Value(); r != nil {
+				r.teardown()
+			}
+		case <-done:
+		}
+		log.Debug("End of handleCtx")
+	}()
+}
+
+// teardown stops the ticker, empties the channel and closes done to end the
+// background goroutine, it's done once whether it's called by Stop or on cancellation
+func (r *RateLimit) teardown() {
+	r.stopOnce.Do(func() {
+		r.log.Debug("Stop Ticker")
 		r.t.Stop()
-		r.log.Debugln("Empty chan")
+		r.cancelFunc()
+		r.log.Debug("Empty chan")
+		r.mu.Lock()
 		r.emptyChan()
-		r.log.Debugln("End of handleCtx")
-	}()
+		r.mu.Unlock()
+		close(r.done)
+	})
 }
 
+// stoppedErr returns why the limiter is stopped: the error of its context if it
+// has been cancelled, ErrStopped otherwise
+func (r *RateLimit) stoppedErr() error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	return ErrStopped
+}
+
+// waitSleepDuration is the default delay between two attempts to get a slot when the
+// next one cannot be predicted (see WithPollInterval)
+const waitSleepDuration = 10 * time.Millisecond
+
 // WaitIfLimitReached wait if limit has been reached
 // do not use IsLimitReached and WaitIFLimitReached in the same algo
+// The waiting calls return as soon as the limiter is stopped (Stop or cancelled context).
 func (r *RateLimit) WaitIfLimitReached() {
-	r.lastCall = time.Now()
+	r.setLastCall()
+	if _, err := r.acquire(context.Background()); err != nil {
+		r.log.Debug("End WaitIfLimitReached")
+	}
+}
+
+// Wait waits for a slot as WaitIfLimitReached, and tells how it ended: nil if the slot
+// was granted, ErrStopped if the limiter is stopped (even before the call), the error
+// of the context given to New if it's cancelled. So that a job can stop instead of
+// running unthrottled after the shutdown.
+func (r *RateLimit) Wait() error {
+	r.setLastCall()
+	_, err := r.acquire(context.Background())
+	return err
+}
 
+// WaitContext waits for a slot until ctx is done, so that each call can have its own
+// deadline. It returns nil once the slot is granted, the error of ctx if ctx is done
+// first (ErrLimitReached without waiting if the deadline of ctx is before the next slot),
+// ErrStopped (or the error of the context given to New) if the limiter is stopped.
+func (r *RateLimit) WaitContext(ctx context.Context) error {
+	r.setLastCall()
+	_, err := r.acquire(ctx)
+	return err
+}
+
+// acquire waits for a slot until ctx or the context of the limiter is done,
+// it returns the state of the window when the slot was granted.
+func (r *RateLimit) acquire(ctx context.Context) (AcquireResult, error) {
+	return r.acquireN(ctx, 1)
+}
+
+// acquireN waits for n slots, granted at once, until ctx or the context of the limiter
+// is done. It does not poll: it waits for the delay before the slots are available or
+// a change of the limiter (refill, new limit, resume, release of a claim) and only falls
+// back to r.pollInterval when the delay is unknown (shared store, slot taken by another
+// call in the meantime).
+func (r *RateLimit) acquireN(ctx context.Context, n int) (AcquireResult, error) {
+	select {
+	case <-r.done:
+		// no slot is granted once stopped, the call must not look throttled
+		return AcquireResult{LimitedBy: -1}, r.stoppedErr()
+	default:
+	}
+	if r.isDraining() {
+		r.overflow("", "draining")
+		return AcquireResult{LimitedBy: -1}, ErrStopped
+	}
+	atomic.AddUint64(&r.attempts, 1)
+	start := r.now()
+	// the signals are taken before trying so that a refill or a shed cannot be missed
+	refilled, shed := r.refillSignal(), globalShedSignal()
+	res := r.tryTake(n)
+	for i := 0; i < r.spins && !res.Granted; i++ {
+		runtime.Gosched()
+		res = r.tryTake(n)
+	}
+	if res.Granted {
+		atomic.AddUint64(&r.immediate, 1)
+		return res, nil
+	}
+	atomic.AddUint64(&r.blockedTotal, 1)
+	r.limitReached()
+	limitedBy := res.LimitedBy
+	if isShedding() {
+		r.overflow("", "global shed")
+		return res, ErrLimitReached
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < r.reserveDelay(n) {
+		// no need to wait, the slot would not be available before the deadline
+		r.overflow("", "deadline before next slot")
+		return res, ErrLimitReached
+	}
+	r.notifyBlock()
+	r.enqueue()
+	defer r.dequeue()
+	var c *claim
+	if n > 1 && r.store == nil {
+		c = &claim{}
+		defer r.unclaim(c)
+	}
+	// woken is set by a refill with WithJitter, the next try is delayed by a random jitter
+	woken := false
 	for {
+		if n > 1 {
+			// the limit can be lowered while waiting (SetLimit, SetDuration): the claim
+			// must not be held for slots which will never be available at once
+			if err := r.checkN(n); err != nil {
+				r.overflow("", "limit lowered")
+				return res, err
+			}
+		}
+		wait := r.pollInterval
+		// park is set when only a change of the limiter can free the slot
+		park := false
+		switch {
+		case woken:
+			wait = rand.N(r.jitter)
+		case r.store == nil:
+			if d := r.reserveDelay(n); d > 0 {
+				wait = d
+				if r.jitter > 0 {
+					// the timer must not beat the refill and skip the jitter
+					wait += rand.N(r.jitter)
+				}
+			} else if r.heldBack(c) {
+				park = true
+			}
+		}
+		woken = false
+		// a nil channel never fires: a parked call waits for the limiter to wake it up
+		var timeout <-chan time.Time
+		var t Timer
+		if !park {
+			t = r.clock.NewTimer(wait)
+			timeout = t.C()
+		}
 		select {
-		case <-r.ctx.Done():
-			r.log.Debugln("End WaitIfLimitReached")
-			return
-		case r.ch <- struct{}{}:
-			return
-		default:
-			time.Sleep(10 * time.Millisecond)
+		case <-ctx.Done():
+			r.overflow("", "context done")
+			stopTimer(t)
+			return res, ctx.Err()
+		case <-r.done:
+			stopTimer(t)
+			return res, r.stoppedErr()
+		case <-shed:
+			stopTimer(t)
+			r.overflow("", "global shed")
+			return res, ErrLimitReached
+		case <-refilled:
+			woken = r.jitter > 0
+		case <-timeout:
+		}
+		stopTimer(t)
+		refilled = r.refillSignal()
+		if woken {
+			continue
+		}
+		if res = r.tryTakeClaim(n, c); res.Granted {
+			atomic.AddUint64(&r.blocked, 1)
+			res.Waited = nonNegative(r.now().Sub(start))
+			res.LimitedBy = limitedBy
+			return res, nil
 		}
 	}
 }
 
+// TryAcquire waits up to timeout for a slot and returns true if it got one, false if
+// the timeout expired or the limiter is stopped first. It does not poll: it waits for
+// the refill of the window or the delay before the next slot.
+func (r *RateLimit) TryAcquire(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	r.setLastCall()
+	_, err := r.acquire(ctx)
+	return err == nil
+}
+
+// tryTake reserves n slots if they are available, it only blocks to query the store (if any).
+// The result holds the state of the window read at the same time.
+// With a store, n must be 1: the store grants one slot at a time.
+func (r *RateLimit) tryTake(n int) AcquireResult {
+	return r.tryTakeClaim(n, nil)
+}
+
+// tryTakeClaim is tryTake for a waiting call holding the claim c, if not nil
+func (r *RateLimit) tryTakeClaim(n int, c *claim) AcquireResult {
+	res := AcquireResult{LimitedBy: -1}
+	if isShedding() {
+		r.mu.RLock()
+		res.Reset = r.untilResetLocked()
+		r.mu.RUnlock()
+		return res
+	}
+	if r.store != nil {
+		// checkN limits the calls of several slots to the in memory window
+		res.Granted = r.takeFromStore()
+		r.mu.RLock()
+		res.Remaining, res.Reset = r.availableLocked(r.now()), r.untilResetLocked()
+		if !res.Granted && !r.paused {
+			// the store holds the main window
+			res.LimitedBy = 0
+		}
+		r.mu.RUnlock()
+	} else {
+		res = r.takeLocal(n, c)
+	}
+	if res.Granted {
+		r.granted(n)
+	}
+	return res
+}
+
+// granted records n slots given to a call
+func (r *RateLimit) granted(n int) {
+	atomic.AddUint64(&r.acquired, uint64(n))
+	r.record(EventGrant)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if !r.lastGrant.IsZero() {
+		r.gaps.add(nonNegative(now.Sub(r.lastGrant)))
+	}
+	r.lastGrant = now
+	r.windowCount += n
+}
+
+// takeLocal reserves n slots of the in memory window if they are available and not
+// held back for another call than the holder of c, it never blocks
+func (r *RateLimit) takeLocal(n int, c *claim) AcquireResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := AcquireResult{LimitedBy: -1}
+	now := r.now()
+	r.tiersAvailableLocked(now) // refills the expired tiers
+	if !r.claimLocked(c) {
+		res.LimitedBy = 0
+	} else if !r.paused {
+		if res.LimitedBy = r.limitingTierLocked(now, n); res.LimitedBy < 0 {
+			r.consumeLocked(n, now)
+			r.tiersConsumeLocked(n)
+			res.Granted = true
+			res.generation, res.grantedAt = r.generation, now
+		}
+	}
+	res.Remaining, res.Reset = r.tiersRemainingLocked(r.availableLocked(now)), r.untilResetLocked()
+	return res
+}
+
+// takeLocalUpTo reserves as many slots of the in memory window as available, up to n,
+// and returns how many it got, it never blocks
+func (r *RateLimit) takeLocalUpTo(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.tiersAvailableLocked(now) // refills the expired tiers
+	got := min(n, r.tiersRemainingLocked(r.availableLocked(now)))
+	if got <= 0 || r.paused || !r.claimLocked(nil) {
+		return 0
+	}
+	r.consumeLocked(got, now)
+	r.tiersConsumeLocked(got)
+	return got
+}
+
+// acquireUpTo consumes up to n slots without waiting and returns how many were granted
+func (r *RateLimit) acquireUpTo(n int) int {
+	r.setLastCall()
+	var got int
+	reason := "limit reached"
+	switch {
+	case isShedding():
+		reason = "global shed"
+	case r.isDraining():
+		reason = "draining"
+	case r.store != nil:
+		// the store only takes one slot at a time
+		for got < n && r.takeFromStore() {
+			got++
+		}
+	default:
+		got = r.takeLocalUpTo(n)
+	}
+	if got == 0 {
+		r.limitReached()
+		r.overflow("", reason)
+		return 0
+	}
+	r.granted(got)
+	return got
+}
+
+// AcquireBatch consumes up to n slots, as many as available, without waiting and returns
+// how many were granted: the caller can process that many items now and defer the others.
+// Concurrent calls never get more slots than available.
+func (r *RateLimit) AcquireBatch(n int) (granted int) {
+	if n <= 0 {
+		return 0
+	}
+	return r.acquireUpTo(n)
+}
+
+// AcquireRemaining consumes all the slots available in the window and returns how
+// many it got (possibly 0). Concurrent calls never get more slots than available.
+func (r *RateLimit) AcquireRemaining() int {
+	// not limited to r.limit, a token bucket can hold more (see WithBurst)
+	return r.acquireUpTo(math.MaxInt)
+}
+
 // IsLimitReached returns true if limit has been reached
 // do not use IsLimitReached and WaitIFLimitReached in the same algo
 func (r *RateLimit) IsLimitReached() bool {
-	r.lastCall = time.Now()
+	r.setLastCall()
 	if r.ctx.Err() != nil {
 		// program is going to be terminated
 		return false
 	}
 	select {
-	case r.ch <- struct{}{}:
+	case <-r.done:
+		// stopped, it no longer limits
 		return false
 	default:
+	}
+	if r.isDraining() {
+		r.overflow("", "draining")
 		return true
 	}
+	if r.tryTake(1).Granted {
+		return false
+	}
+	r.limitReached()
+	r.overflow("", "limit reached")
+	return true
+}
+
+// IsLimitReachedContext is IsLimitReached for a call with its own context: if ctx is
+// already done, it returns true and the error of ctx without consuming a slot
+func (r *RateLimit) IsLimitReachedContext(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	return r.IsLimitReached(), nil
 }
 
+// Allow consumes a slot if one is available and returns true, it returns false otherwise
+// without consuming anything. It's the opposite of IsLimitReached, named as Allow of
+// golang.org/x/time/rate: once the limiter is stopped, it returns true.
+func (r *RateLimit) Allow() bool {
+	return !r.IsLimitReached()
+}
+
+// GetLastCall returns the time of the last call to WaitIfLimitReached or IsLimitReached,
+// whether it got a slot or not, as given by the now source of the limiter (see WithNowFunc)
 func (r *RateLimit) GetLastCall() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.lastCall
 }
 
+// GetLastGrant returns the time a slot was last granted, zero if none was granted.
+// Unlike GetLastCall, it's not updated by denied calls, so it tells when the limiter
+// was really used (e.g. to evict idle limiters).
+func (r *RateLimit) GetLastGrant() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastGrant
+}
+
+func (r *RateLimit) setLastCall() {
+	r.mu.Lock()
+	r.lastCall = r.now()
+	r.mu.Unlock()
+}
+
+// Waiters returns the number of calls currently waiting for a slot
+func (r *RateLimit) Waiters() int {
+	return int(atomic.LoadInt64(&r.waiters))
+}
+
+// enqueue registers a waiting call
+func (r *RateLimit) enqueue() {
+	depth := atomic.AddInt64(&r.waiters, 1)
+	r.record(EventWaitStart)
+	if r.onEnqueue != nil {
+		r.onEnqueue(int(depth))
+	}
+}
+
+// dequeue unregisters a waiting call
+func (r *RateLimit) dequeue() {
+	depth := atomic.AddInt64(&r.waiters, -1)
+	r.record(EventWaitEnd)
+	if r.onDequeue != nil {
+		r.onDequeue(int(depth))
+	}
+	if depth == 0 && r.isDraining() {
+		r.signalDrained()
+	}
+}
+
+// notifyBlock calls the block callback for the first call waiting during the window
+func (r *RateLimit) notifyBlock() {
+	if r.onBlock == nil {
+		return
+	}
+	r.mu.Lock()
+	first := !r.blockNotified
+	r.blockNotified = true
+	r.mu.Unlock()
+	if first {
+		r.onBlock()
+	}
+}
+
+// limitReached records a call which could not get a slot immediately
+func (r *RateLimit) limitReached() {
+	atomic.AddUint64(&r.throttled, 1)
+	r.record(EventDeny)
+	r.logLimitReached()
+}
+
+// overflow reports a denied call to the overflow log, if any
+func (r *RateLimit) overflow(tag string, reason string) {
+	if r.overflowLog != nil {
+		r.overflowLog(tag, reason)
+	}
+}
+
+// isFull returns true if all the slots of the window are used
+func (r *RateLimit) isFull() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.availableLocked(r.now()) == 0
+}
+
+// reserveDelay returns how long to wait before n slots are available, 0 if they are available now
+func (r *RateLimit) reserveDelay(n int) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	d := r.mainDelayLocked(now, n)
+	if td := r.tiersDelayLocked(now, n); td > d {
+		d = td
+	}
+	return d
+}
+
+// untilResetLocked returns the time left before the next refill, r.mu must be held
+func (r *RateLimit) untilResetLocked() time.Duration {
+	switch r.algorithm {
+	case GCRA, LeakyBucket:
+		// no window, it's the time left before the burst is fully available again
+		return nonNegative(r.tat.Sub(r.now()))
+	case TokenBucket:
+		return r.bucketFullDelayLocked(r.now())
+	case SlidingWindowLog:
+		return r.logFreeDelayLocked(r.now())
+	}
+	d := r.d
+	if len(r.ch) == cap(r.ch) {
+		// the window is saturated so the penalty (if any) will delay the refill
+		d = addDuration(d, r.penalty)
+	}
+	return nonNegative(r.windowStart.Add(d).Sub(r.now()))
+}
+
+// addDuration returns a+b for non negative durations, saturating instead of overflowing
+func addDuration(a, b time.Duration) time.Duration {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// scale returns n*num/den without overflowing the intermediate product,
+// n must be <= den so that the result fits in an int
+func scale(n, num, den int) int {
+	hi, lo := bits.Mul64(uint64(n), uint64(num))
+	q, _ := bits.Div64(hi, lo, uint64(den))
+	return int(q)
+}
+
+// nonNegative clamps d to 0, a negative duration can be computed when the clock
+// goes backwards or when the ticker is late
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ForceRefill ends the current window as if the ticker fired: the slots are freed and
+// the window end callback is called. It's meant to test code handling the refills
+// (retries...) without waiting for the ticker. It does nothing once the limiter is stopped.
+func (r *RateLimit) ForceRefill() {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.log.Debug("Forced refill")
+	r.refill()
+}
+
+// Reset frees all the slots of the current window at once, e.g. after reconfiguring the
+// upstream service. Unlike ForceRefill, the window is not ended: the refills keep their
+// schedule and the window end callback is not called. It does nothing once the limiter is stopped.
+func (r *RateLimit) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.emptyChan()
+	r.tat = time.Time{}
+	r.tokensAt = time.Time{}
+	r.callLog = nil
+	for _, t := range r.tiers {
+		t.count = 0
+	}
+	r.generation++
+	r.wakeLocked()
+	r.log.Debug("Reset")
+}
+
+// refillSignal returns a channel closed at the next refill or change of the limiter
+// which can free slots
+func (r *RateLimit) refillSignal() <-chan struct{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.refilled
+}
+
+// wakeLocked wakes up the waiting calls so that they try again to get a slot, r.mu must be held
+func (r *RateLimit) wakeLocked() {
+	close(r.refilled)
+	r.refilled = make(chan struct{})
+}
+
+// refill empties the channel and starts a new window
+func (r *RateLimit) refill() {
+	atomic.AddUint64(&r.ticks, 1)
+	atomic.StoreUint64(&r.prevImmediate, atomic.SwapUint64(&r.immediate, 0))
+	atomic.StoreUint64(&r.prevBlocked, atomic.SwapUint64(&r.blocked, 0))
+	r.mu.Lock()
+	count, start, drained := r.windowCount, r.windowStart, len(r.ch)
+	r.emptyChan()
+	r.windowStart = r.now()
+	r.recent.add(count, r.windowStart.Sub(start))
+	r.windowCount = 0
+	r.probesUsed = 0
+	r.blockNotified = false
+	if r.algorithm == FixedWindow {
+		// the other algorithms have no window, the refill does not free their slots
+		r.generation++
+	}
+	end := r.windowStart
+	r.wakeLocked()
+	r.mu.Unlock()
+	r.record(EventRefill)
+	if r.onWindowEnd != nil {
+		r.callHook("Window end", func() { r.onWindowEnd(count, start, end) })
+	}
+	if r.onReset != nil {
+		r.callHook("Reset", func() { r.onReset(drained) })
+	}
+}
+
+// callHook calls a callback of the background goroutine, a panic of the callback is
+// logged instead of killing the goroutine
+func (r *RateLimit) callHook(name string, fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			r.log.Error(name+" callback panicked", "err", err)
+		}
+	}()
+	fn()
+}
+
+// SetLimit changes the number of calls allowed per window.
+// The occupancy of the current window is scaled to keep the same used/limit ratio,
+// rounded down: shrinking from 100 (50 used) to 50 keeps 25 used slots, growing
+// from 10 (5 used) to 20 gives 10 used slots. The new limit applies immediately.
+// The calls waiting for a slot are served under the new limit as slots become available,
+// the grants never exceed it: after a shrink, they can wait longer (until the next window).
+// It returns ErrInvalidParams if limit <= 0 or, with WithStrictValidation, if the rate
+// is above MaxSensibleRate.
+func (r *RateLimit) SetLimit(limit int) error {
+	if limit <= 0 {
+		return ErrInvalidParams
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkRate(limit, r.d); err != nil {
+		return err
+	}
+	if r.algorithm == TokenBucket {
+		r.bucketSetLimitLocked(limit, r.now())
+	}
+	used := scale(len(r.ch), limit, r.limit)
+	ch := make(chan struct{}, limit)
+	for i := 0; i < used; i++ {
+		ch <- struct{}{}
+	}
+	r.ch = ch
+	r.limit = limit
+	r.wakeLocked()
+	r.log.Debug("Limit set", "limit", limit, "used", used)
+	r.record(EventReconfigure)
+	return nil
+}
+
+// SetDuration changes the duration of the windows. The current window keeps its slots
+// and ends d after its start (at once if that's already past), the next ones last d.
+// With WithWindowAnchor, the refills stay aligned on the anchor.
+// It returns ErrInvalidParams if d < MinDuration or, with WithStrictValidation, if the
+// rate is above MaxSensibleRate. It does nothing once the limiter is stopped.
+func (r *RateLimit) SetDuration(d time.Duration) error {
+	if d < MinDuration {
+		return ErrInvalidParams
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+	if err := r.checkRate(r.limit, d); err != nil {
+		return err
+	}
+	now := r.now()
+	if r.algorithm == TokenBucket {
+		// the tokens gathered so far were at the previous rate
+		r.tokens, r.tokensAt = r.tokensLocked(now), now
+	}
+	if !r.anchor.IsZero() {
+		r.windowStart = anchoredWindowStart(r.anchor, now, d)
+	}
+	// the ticker needs a positive delay
+	first := max(r.windowStart.Add(d).Sub(now), 1)
+	r.d = d
+	r.t.Reset(first)
+	r.shortWindow = first != d
+	r.wakeLocked()
+	r.log.Debug("Duration set", "duration", d)
+	r.record(EventReconfigure)
+	return nil
+}
+
+// emptyChan drains the channel until it's empty, without relying on a length read
+// beforehand, r.mu must be held
 func (r *RateLimit) emptyChan() {
-	if r.ctx.Err() == nil {
-		length := len(r.ch)
-		for i := 0; i < length; i++ {
-			_, ok := <-r.ch
+	if r.ctx.Err() != nil {
+		return
+	}
+	for {
+		select {
+		case _, ok := <-r.ch:
 			if !ok {
-				break // channel is closed
+				return // channel is closed
 			}
+		default:
+			return
 		}
 	}
 }
 
-func initLog(debugLevel string) *logrus.Logger {
-	l := logrus.New()
-	// Log as JSON instead of the default ASCII formatter.
-	//log.SetFormatter(&log.JSONFormatter{})
-	l.SetFormatter(&logrus.TextFormatter{
-		DisableColors:    false,
-		FullTimestamp:    false,
-		DisableTimestamp: true,
-	})
+// stopJoinTimeout is the longest time Stop waits for the goroutines of the limiter to end,
+// the background one can be busy in the window end callback
+const stopJoinTimeout = 100 * time.Millisecond
 
-	// Output to stdout instead of the default stderr
-	// Can be any io.Writer, see below for File example
-	l.SetOutput(os.Stdout)
-
-	switch debugLevel {
-	case "debug":
-		l.SetLevel(logrus.DebugLevel)
-	case "info":
-		l.SetLevel(logrus.InfoLevel)
-	case "warn":
-		l.SetLevel(logrus.WarnLevel)
-	case "error":
-		l.SetLevel(logrus.ErrorLevel)
-	default:
-		l.SetLevel(logrus.InfoLevel)
+// Stop close background Goroutine
+// It's not needed if the context given to New is cancelled.
+// After Stop, the limiter no longer rate-limits: the waiting calls return ErrStopped,
+// WaitIfLimitReached returns at once and IsLimitReached returns false.
+// It returns once the goroutines of the limiter have ended, or after stopJoinTimeout.
+// It can be called several times, and concurrently.
+func (r *RateLimit) Stop() {
+	r.teardown()
+	timeout := r.clock.After(stopJoinTimeout)
+	for _, exited := range []chan struct{}{r.exited, r.ctxExited} {
+		select {
+		case <-exited:
+		case <-timeout:
+			return
+		}
 	}
-	return l
 }
 
-// Stop close background Goroutine
-func (r *RateLimit) Stop() {
-	r.log.Debugln("Stop Ticker")
-	r.t.Stop()
-	r.log.Debugln("Empty chan")
-	r.emptyChan()
-	time.Sleep(100 * time.Millisecond)
+// StopAll stops the limiters concurrently, so that it takes about the time of one Stop
+func StopAll(limiters ...*RateLimit) {
+	var wg sync.WaitGroup
+	for _, r := range limiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// anchoredWindowStart returns the start of the window containing now for windows of
+// duration d aligned on anchor
+func anchoredWindowStart(anchor, now time.Time, d time.Duration) time.Time {
+	offset := now.Sub(anchor) % d
+	if offset < 0 {
+		offset += d
+	}
+	return now.Add(-offset)
 }
@@ -0,0 +1,996 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitContextFailsFastWhenTheDeadlineIsTooSoon(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := r.WaitContext(ctx); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("WaitContext() = %v, want ErrLimitReached", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("WaitContext() returned after %v, it should not wait for the deadline", elapsed)
+	}
+}
+
+func TestWaitContextFailsFastWithAnotherClock(t *testing.T) {
+	// the deadline of ctx is on the wall clock, the delay of the limiter on its own clock
+	r, err := New(context.Background(), time.Hour, 1, WithClock(newFakeClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.WaitContext(ctx); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("WaitContext() = %v, want ErrLimitReached without waiting", err)
+	}
+}
+
+func TestWaitContextWaitsWhenTheDeadlineCanBeMet(t *testing.T) {
+	r, err := New(context.Background(), 20*time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.WaitContext(ctx); err != nil {
+		t.Fatalf("WaitContext() = %v, want nil", err)
+	}
+}
+
+func TestCallsDoNotRestartTheWindow(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	clock.Advance(30 * time.Second)
+	r.IsLimitReached()
+	if got := r.TimeUntilReset(); got != 30*time.Second {
+		t.Fatalf("TimeUntilReset() = %v, want 30s", got)
+	}
+}
+
+func TestSetLimitKeepsTheUsedRatio(t *testing.T) {
+	for _, tc := range []struct {
+		limit, used, newLimit, wantRemaining int
+	}{
+		{100, 50, 50, 25},
+		{10, 5, 20, 10},
+		{10, 10, 5, 0},
+		{3, 1, 2, 2}, // 2/3 used slot rounded down
+		{10, 0, 1, 1},
+	} {
+		r, err := New(context.Background(), time.Hour, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.AcquireBatch(tc.used); got != tc.used {
+			t.Fatalf("AcquireBatch(%d) = %d", tc.used, got)
+		}
+		if err := r.SetLimit(tc.newLimit); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Remaining(); got != tc.wantRemaining {
+			t.Errorf("%d/%d used, SetLimit(%d): Remaining() = %d, want %d", tc.used, tc.limit, tc.newLimit, got, tc.wantRemaining)
+		}
+		r.Stop()
+	}
+}
+
+func TestSetLimitInvalid(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.SetLimit(0); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("SetLimit(0) = %v, want ErrInvalidParams", err)
+	}
+}
+
+func TestEnqueueDequeueBalanced(t *testing.T) {
+	const waiters = 10
+	var mu sync.Mutex
+	var enqueued, dequeued, maxDepth int
+	r, err := New(context.Background(), time.Hour, 1,
+		WithOnEnqueue(func(depth int) {
+			mu.Lock()
+			defer mu.Unlock()
+			enqueued++
+			maxDepth = max(maxDepth, depth)
+		}),
+		WithOnDequeue(func(depth int) {
+			mu.Lock()
+			defer mu.Unlock()
+			dequeued++
+			if depth < 0 || depth >= waiters {
+				t.Errorf("dequeue depth %d", depth)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Wait(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	eventually(t, func() bool { return r.Waiters() == waiters })
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for refills := 0; ; refills++ {
+		select {
+		case <-done:
+			mu.Lock()
+			defer mu.Unlock()
+			if enqueued != waiters || dequeued != waiters {
+				t.Fatalf("%d enqueued, %d dequeued, want %d", enqueued, dequeued, waiters)
+			}
+			if maxDepth != waiters {
+				t.Fatalf("max depth %d, want %d", maxDepth, waiters)
+			}
+			if r.Waiters() != 0 {
+				t.Fatalf("Waiters() = %d at the end", r.Waiters())
+			}
+			return
+		case <-time.After(time.Millisecond):
+			r.ForceRefill()
+		}
+	}
+}
+
+func TestImmediateGrantIsNotEnqueued(t *testing.T) {
+	calls := 0
+	r, err := New(context.Background(), time.Hour, 5, WithOnEnqueue(func(int) { calls++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for i := 0; i < 5; i++ {
+		r.WaitIfLimitReached()
+	}
+	if calls != 0 {
+		t.Fatalf("%d enqueue events for immediate grants", calls)
+	}
+}
+
+func TestPenaltyCooldownOncePerSaturation(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock), WithPenaltyCooldown(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	ticks := func() uint64 { return atomic.LoadUint64(&r.ticks) }
+
+	// saturated window: the refill is delayed by the penalty
+	r.IsLimitReached()
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return clock.Timers() == 1 })
+	if r.Remaining() != 0 || ticks() != 0 {
+		t.Fatalf("refilled before the end of the penalty: Remaining() = %d", r.Remaining())
+	}
+	clock.Advance(30 * time.Second)
+	eventually(t, func() bool { return ticks() == 1 && r.Remaining() == 1 })
+
+	// window not saturated: no penalty
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return ticks() == 2 })
+	if clock.Timers() != 0 {
+		t.Fatal("penalty applied to a window which was not saturated")
+	}
+
+	// saturated again: penalty again
+	r.IsLimitReached()
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return clock.Timers() == 1 })
+	if ticks() != 2 {
+		t.Fatal("refilled before the end of the second penalty")
+	}
+	clock.Advance(30 * time.Second)
+	eventually(t, func() bool { return ticks() == 3 && r.Remaining() == 1 })
+}
+
+func TestPenaltyCooldownInvalid(t *testing.T) {
+	if _, err := New(context.Background(), time.Second, 1, WithPenaltyCooldown(-time.Second)); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("New() error = %v with a negative penalty, want ErrInvalidParams", err)
+	}
+}
+
+func TestCountersWithLargeValues(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	atomic.StoreUint64(&r.acquired, math.MaxUint64-1)
+	// the sum of the immediate acquisitions does not fit in an uint64
+	atomic.StoreUint64(&r.immediate, math.MaxUint64/2+10)
+	atomic.StoreUint64(&r.prevImmediate, math.MaxUint64/2+10)
+	atomic.StoreUint64(&r.blocked, 100)
+	r.AcquireBatch(3)
+	st := r.Stats()
+	if st.Acquired != 1 {
+		t.Errorf("Acquired = %d, want the counter to wrap around to 1", st.Acquired)
+	}
+	if st.BlockedRatio < 0 || st.BlockedRatio > 1e-9 || math.IsNaN(st.BlockedRatio) {
+		t.Errorf("BlockedRatio = %v, want about 0", st.BlockedRatio)
+	}
+}
+
+func TestOverflowSafeArithmetic(t *testing.T) {
+	if got := scale(math.MaxInt-1, math.MaxInt, math.MaxInt); got != math.MaxInt-1 {
+		t.Errorf("scale(MaxInt-1, MaxInt, MaxInt) = %d", got)
+	}
+	if got := scale(3, 1<<62, 1<<62); got != 3 {
+		t.Errorf("scale(3, 1<<62, 1<<62) = %d", got)
+	}
+	if got := addDuration(math.MaxInt64-1, time.Hour); got != math.MaxInt64 {
+		t.Errorf("addDuration saturated to %v", got)
+	}
+	if got := addDuration(time.Second, time.Second); got != 2*time.Second {
+		t.Errorf("addDuration(1s, 1s) = %v", got)
+	}
+}
+
+func TestCancelledContextTearsDownWithoutStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := New(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.IsLimitReached()
+	waiting := make(chan error, 1)
+	go func() { waiting <- r.WaitContext(context.Background()) }()
+	cancel()
+	for name, ch := range map[string]chan struct{}{"done": r.done, "background goroutine": r.exited, "context goroutine": r.ctxExited} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("%s not closed after the context was cancelled", name)
+		}
+	}
+	if err := <-waiting; !errors.Is(err, context.Canceled) {
+		t.Fatalf("waiting call returned %v, want context.Canceled", err)
+	}
+}
+
+func TestScaleToMinDuration(t *testing.T) {
+	for _, tc := range []struct {
+		d     time.Duration
+		limit int
+		want  int
+	}{
+		{600 * time.Microsecond, 10, 17},
+		{500 * time.Microsecond, 3, 6},
+		{time.Microsecond, 1, 1000},
+		{3 * time.Nanosecond, 1, 333334},
+		{time.Nanosecond, math.MaxInt, math.MaxInt},
+		{time.Nanosecond, math.MaxInt / 1000, math.MaxInt},
+	} {
+		d, limit := scaleToMinDuration(tc.d, tc.limit)
+		if d != MinDuration || limit != tc.want {
+			t.Errorf("scaleToMinDuration(%v, %d) = %v, %d, want %v, %d", tc.d, tc.limit, d, limit, MinDuration, tc.want)
+		}
+	}
+}
+
+func TestSubMillisecondDuration(t *testing.T) {
+	r, err := New(context.Background(), 600*time.Microsecond, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if rate := r.Rate(); rate < 16667 {
+		t.Fatalf("Rate() = %v, want at least the 16667/s asked", rate)
+	}
+	start := time.Now()
+	for range 100 {
+		r.WaitIfLimitReached()
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("100 waits took %v", elapsed)
+	}
+	// the window is refilled every MinDuration at most, not every 600µs
+	ticks := atomic.LoadUint64(&r.ticks)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadUint64(&r.ticks) - ticks; n > 60 {
+		t.Fatalf("%d refills in 50ms", n)
+	}
+}
+
+func TestDeniedCallsDoNotAdvanceGetLastGrant(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Hour, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if !r.GetLastGrant().IsZero() {
+		t.Fatalf("GetLastGrant() = %v before any grant", r.GetLastGrant())
+	}
+	granted := clock.Now()
+	r.IsLimitReached()
+	clock.Advance(time.Minute)
+	if !r.IsLimitReached() {
+		t.Fatal("second call granted")
+	}
+	if got := r.GetLastGrant(); !got.Equal(granted) {
+		t.Fatalf("GetLastGrant() = %v, want %v", got, granted)
+	}
+	if got := r.GetLastCall(); !got.Equal(clock.Now()) {
+		t.Fatalf("GetLastCall() = %v, want %v", got, clock.Now())
+	}
+}
+
+func TestAcquireRemainingConcurrent(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireBatch(10)
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			total.Add(int64(r.AcquireRemaining()))
+		}()
+	}
+	wg.Wait()
+	if got := total.Load(); got != 90 {
+		t.Fatalf("%d slots acquired by the concurrent calls, want the 90 available", got)
+	}
+}
+
+func TestAcquireRemainingTakesTheWholeBurst(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Second, 10, WithClock(clock), WithAlgorithm(TokenBucket), WithBurst(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.AcquireRemaining(); got != 50 {
+		t.Fatalf("AcquireRemaining() = %d, want the burst of 50", got)
+	}
+	if got := r.AcquireRemaining(); got != 0 {
+		t.Fatalf("AcquireRemaining() = %d on an empty bucket", got)
+	}
+}
+
+func TestSetLimitWithManyWaitersNeverExceedsTheNewLimit(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 10, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireBatch(10)
+	const waiters = 100
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	for range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r.Wait() == nil {
+				granted.Add(1)
+			}
+		}()
+	}
+	eventually(t, func() bool { return r.Waiters() == waiters })
+	for _, limit := range []int{3, 7, 1, 12, 2, 5} {
+		// concurrent reconfigurations while the window is full, the last one wins
+		var reconf sync.WaitGroup
+		for i := range 4 {
+			reconf.Add(1)
+			go func() {
+				defer reconf.Done()
+				for j := range 50 {
+					_ = r.SetLimit(1 + (i*50+j)%20)
+				}
+			}()
+		}
+		reconf.Wait()
+		if err := r.SetLimit(limit); err != nil {
+			t.Fatal(err)
+		}
+		before := granted.Load()
+		clock.Advance(time.Minute)
+		eventually(t, func() bool { return granted.Load()-before >= int64(limit) })
+		// no waiter gets a slot beyond the new limit
+		time.Sleep(10 * time.Millisecond)
+		if got := granted.Load() - before; got != int64(limit) {
+			t.Fatalf("%d waiters served in a window of %d", got, limit)
+		}
+	}
+	r.Stop()
+	wg.Wait()
+}
+
+func TestForceRefill(t *testing.T) {
+	var counts []int
+	r, err := New(context.Background(), time.Hour, 2, WithOnWindowEnd(func(count int, _, _ time.Time) {
+		counts = append(counts, count)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.IsLimitReached()
+	r.IsLimitReached()
+	r.ForceRefill()
+	if r.Remaining() != 2 || len(counts) != 1 || counts[0] != 2 {
+		t.Fatalf("after ForceRefill: %d remaining, window end callbacks %v", r.Remaining(), counts)
+	}
+	r.Stop()
+	r.ForceRefill()
+	if len(counts) != 1 {
+		t.Fatal("ForceRefill refilled a stopped limiter")
+	}
+}
+
+func TestStopAllStopsConcurrently(t *testing.T) {
+	const n = 10
+	limiters := make([]*RateLimit, n)
+	for i := range limiters {
+		// a slow window end callback delays the exit of the background goroutine,
+		// each Stop waits up to 40ms for it
+		r, err := New(context.Background(), MinDuration, 1, WithOnWindowEnd(func(int, time.Time, time.Time) {
+			time.Sleep(40 * time.Millisecond)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		limiters[i] = r
+	}
+	time.Sleep(5 * time.Millisecond)
+	start := time.Now()
+	StopAll(limiters...)
+	if elapsed := time.Since(start); elapsed > n*40*time.Millisecond/2 {
+		t.Fatalf("StopAll took %v, about the time of %d sequential Stop", elapsed, n)
+	}
+	for i, r := range limiters {
+		select {
+		case <-r.done:
+		default:
+			t.Fatalf("limiter %d not stopped", i)
+		}
+	}
+}
+
+func TestNewWithContextAlreadyDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, err := New(ctx, time.Second, 1)
+	if r != nil || !errors.Is(err, context.Canceled) || errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("New() = %v, %v, want an error wrapping context.Canceled", r, err)
+	}
+	// the parameters are checked first
+	if _, err := New(ctx, 0, 1); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("New() = %v, want ErrInvalidParams", err)
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	r, err := New(context.Background(), 50*time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.TryAcquire(0) {
+		t.Fatal("slot available not acquired")
+	}
+	start := time.Now()
+	if !r.TryAcquire(time.Second) {
+		t.Fatal("slot not acquired after the refill")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("TryAcquire waited %v for a window of 50ms", elapsed)
+	}
+	start = time.Now()
+	if r.TryAcquire(5 * time.Millisecond) {
+		t.Fatal("slot acquired before the refill")
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Fatalf("TryAcquire returned after %v with a timeout of 5ms", elapsed)
+	}
+	r.Stop()
+	if r.TryAcquire(time.Second) {
+		t.Fatal("slot acquired from a stopped limiter")
+	}
+}
+
+func TestAcquireBatchPartialFill(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, tc := range []struct{ n, want int }{{4, 4}, {0, 0}, {-1, 0}, {10, 6}, {3, 0}} {
+		if got := r.AcquireBatch(tc.n); got != tc.want {
+			t.Fatalf("AcquireBatch(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+	r.Reset()
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			total.Add(int64(r.AcquireBatch(3)))
+		}()
+	}
+	wg.Wait()
+	if got := total.Load(); got != 10 {
+		t.Fatalf("%d slots granted to the concurrent batches, want 10", got)
+	}
+}
+
+func TestWaitingCallsDoNotPoll(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	done := make(chan error, 1)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return clock.Timers() == 1 })
+	denied := atomic.LoadUint64(&r.throttled)
+	// the call sleeps until the refill, it does not try again every poll interval
+	for range 10 {
+		clock.Advance(waitSleepDuration)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if clock.Timers() != 1 || atomic.LoadUint64(&r.throttled) != denied {
+		t.Fatal("the waiting call polled")
+	}
+	// and it's woken up as soon as a slot is freed
+	r.Reset()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiting call was not woken up by Reset")
+	}
+}
+
+func TestHeldBackCallsDoNotPoll(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 3, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	// paused: the slots are available but held back until Resume
+	r.Pause()
+	done := make(chan error, 2)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	time.Sleep(10 * time.Millisecond)
+	if clock.Timers() != 0 {
+		t.Fatal("the call waiting for Resume polls")
+	}
+	r.Resume()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// claimed: the slots left are held back for a call of several slots
+	go func() { done <- r.WaitN(3) }()
+	eventually(t, func() bool { return r.Waiters() == 1 && clock.Timers() == 1 })
+	// woken up, the call of several slots takes the claim and waits again
+	r.Pause()
+	r.Resume()
+	eventually(t, func() bool {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.claim != nil
+	})
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 2 })
+	time.Sleep(10 * time.Millisecond)
+	if clock.Timers() != 1 {
+		t.Fatal("the call waiting for the release of the claim polls")
+	}
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// the call of one slot waits for the next window
+	eventually(t, func() bool { return r.Waiters() == 1 && clock.Timers() == 1 })
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkWakeUp(b *testing.B) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	done := make(chan error)
+	for b.Loop() {
+		go func() { done <- r.Wait() }()
+		for r.Waiters() == 0 {
+			runtime.Gosched()
+		}
+		r.Reset()
+		if err := <-done; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWaitContextPerCallCancellation(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() { cancelled <- r.WaitContext(ctx) }()
+	other := make(chan error, 1)
+	go func() { other <- r.WaitContext(context.Background()) }()
+	eventually(t, func() bool { return r.Waiters() == 2 })
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitContext() = %v, want context.Canceled", err)
+	}
+	// the other call and the limiter are not affected
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	r.Reset()
+	if err := <-other; err != nil {
+		t.Fatalf("WaitContext() = %v, want nil", err)
+	}
+	go func() { other <- r.WaitContext(context.Background()) }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	r.Stop()
+	if err := <-other; !errors.Is(err, ErrStopped) {
+		t.Fatalf("WaitContext() = %v after Stop, want ErrStopped", err)
+	}
+}
+
+func TestResetFreesTheWindow(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireBatch(2)
+	r.Reset()
+	if r.IsLimitReached() || r.IsLimitReached() {
+		t.Fatal("slot denied after Reset")
+	}
+	// the refills keep their schedule
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.Remaining() == 2 })
+}
+
+func TestSetLimitMidStream(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 4, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, tc := range []struct {
+		limit, used int
+	}{{8, 2}, {2, 1}, {5, 0}} {
+		r.AcquireBatch(tc.used)
+		if err := r.SetLimit(tc.limit); err != nil {
+			t.Fatal(err)
+		}
+		// the new cap applies to the current window, then to the next ones
+		for range 2 {
+			r.AcquireRemaining()
+			if used := r.Stats().InUse; used != tc.limit || !r.IsLimitReached() {
+				t.Fatalf("limit %d: %d slots used once all were taken", tc.limit, used)
+			}
+			clock.Advance(time.Minute)
+			eventually(t, func() bool { return r.Remaining() == tc.limit })
+		}
+	}
+}
+
+func TestSetDurationChangesTheRefills(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	ends := make(chan time.Time, 10)
+	r, err := New(context.Background(), 100*time.Millisecond, 1, WithClock(clock), WithOnWindowEnd(func(_ int, _, windowEnd time.Time) {
+		ends <- windowEnd
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	clock.Advance(20 * time.Millisecond)
+	if err := r.SetDuration(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// the current window ends 50ms after its start, then every 50ms
+	for _, want := range []time.Duration{50, 100, 150, 200} {
+		clock.Advance(start.Add(want * time.Millisecond).Sub(clock.Now()))
+		select {
+		case end := <-ends:
+			if !end.Equal(start.Add(want * time.Millisecond)) {
+				t.Fatalf("window ended at %v, want %v", end.Sub(start), want*time.Millisecond)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no refill")
+		}
+	}
+	if err := r.SetDuration(time.Microsecond); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("SetDuration(1µs) = %v, want ErrInvalidParams", err)
+	}
+}
+
+func TestStopIsIdempotent(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Stop()
+		}()
+	}
+	wg.Wait()
+	r.Stop()
+	// Stop joins the background goroutine, it does not sleep
+	if elapsed := time.Since(start); elapsed >= stopJoinTimeout {
+		t.Fatalf("Stop took %v", elapsed)
+	}
+	select {
+	case <-r.exited:
+	default:
+		t.Fatal("background goroutine still running after Stop")
+	}
+	// it no longer limits
+	for range 3 {
+		if r.IsLimitReached() {
+			t.Fatal("limit reached after Stop")
+		}
+	}
+}
+
+func TestWaitTellsHowItEnded(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait() = %v with a slot available, want nil", err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	r.Stop()
+	if err := <-errs; !errors.Is(err, ErrStopped) {
+		t.Fatalf("Wait() unblocked by Stop = %v, want ErrStopped", err)
+	}
+	if err := r.Wait(); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Wait() after Stop = %v, want ErrStopped", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err = New(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	go func() { errs <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() unblocked by the cancellation = %v, want context.Canceled", err)
+	}
+}
+
+func TestIsLimitReachedContext(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if reached, err := r.IsLimitReachedContext(ctx); !reached || !errors.Is(err, context.Canceled) {
+		t.Fatalf("IsLimitReachedContext() = %v, %v with a cancelled context", reached, err)
+	}
+	if r.Remaining() != 1 {
+		t.Fatal("slot consumed with a cancelled context")
+	}
+	if reached, err := r.IsLimitReachedContext(context.Background()); reached || err != nil {
+		t.Fatalf("IsLimitReachedContext() = %v, %v, want false, nil", reached, err)
+	}
+	if reached, err := r.IsLimitReachedContext(context.Background()); !reached || err != nil {
+		t.Fatalf("IsLimitReachedContext() = %v, %v, want true, nil", reached, err)
+	}
+}
+
+func TestCancelAndStopConcurrently(t *testing.T) {
+	for range 50 {
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := New(ctx, time.Hour, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.IsLimitReached()
+		errs := make(chan error, 4)
+		for range cap(errs) {
+			go func() { errs <- r.Wait() }()
+		}
+		var wg sync.WaitGroup
+		for i := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if i%2 == 0 {
+					cancel()
+				} else {
+					r.Stop()
+				}
+			}()
+		}
+		wg.Wait()
+		for range cap(errs) {
+			if err := <-errs; !errors.Is(err, ErrStopped) && !errors.Is(err, context.Canceled) {
+				t.Fatalf("waiting call = %v, want ErrStopped or context.Canceled", err)
+			}
+		}
+		r.Stop()
+		cancel()
+	}
+}
+
+func TestStopLeaksNoGoroutine(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for range 100 {
+		r, err := New(context.Background(), time.Hour, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Stop()
+	}
+	eventually(t, func() bool { return runtime.NumGoroutine() <= before })
+}
+
+func TestAllowConsumesOnlyOnSuccess(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Allow() || r.Remaining() != 1 {
+		t.Fatalf("Allow() did not consume a slot, %d remaining", r.Remaining())
+	}
+	if !r.Allow() {
+		t.Fatal("second slot not allowed")
+	}
+	if r.Allow() || r.Remaining() != 0 {
+		t.Fatal("call allowed over the limit")
+	}
+	if st := r.Stats(); st.Acquired != 2 || st.Throttled != 1 {
+		t.Fatalf("Stats() = %+v, want 2 acquired and 1 throttled", st)
+	}
+	r.Stop()
+	if !r.Allow() {
+		t.Fatal("call not allowed by a stopped limiter")
+	}
+}
+
+func TestStopReturnsOnceTheGoroutinesExit(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+	// the fake clock does not move: Stop returns because the goroutines exited,
+	// not because of the join timeout
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop not returned once the goroutines exited")
+	}
+	for _, exited := range []chan struct{}{r.exited, r.ctxExited} {
+		select {
+		case <-exited:
+		default:
+			t.Fatal("goroutine still running after Stop")
+		}
+	}
+}
+
+func TestEachWindowResetsUnderLoad(t *testing.T) {
+	clock := newFakeClock()
+	const limit = 5
+	counts := make(chan int, 100)
+	r, err := New(context.Background(), time.Minute, limit, WithClock(clock), WithOnWindowEnd(func(count int, _, _ time.Time) {
+		counts <- count
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	var wg sync.WaitGroup
+	for range 4 * limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.Wait() == nil {
+			}
+		}()
+	}
+	const windows = 20
+	for range windows {
+		// the waiting calls take all the slots of the window
+		eventually(t, func() bool { return r.Remaining() == 0 && r.Waiters() > 0 })
+		clock.Advance(time.Minute)
+		waitRefill(t, r, clock)
+	}
+	r.Stop()
+	wg.Wait()
+	for i := range windows {
+		if count := <-counts; count != limit {
+			t.Fatalf("window %d: %d slots granted, want %d: the window was not fully reset", i, count, limit)
+		}
+	}
+}
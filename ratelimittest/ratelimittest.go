@@ -0,0 +1,35 @@
+// Package ratelimittest provides helpers to test code using ratelimit
+package ratelimittest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// settleTimeout is how long AssertNoLeaks waits for the goroutines to exit
+const settleTimeout = 2 * time.Second
+
+// settleInterval is the delay between two counts of the goroutines
+const settleInterval = 10 * time.Millisecond
+
+// AssertNoLeaks fails t if goroutines started by fn are still running after it returned.
+// fn is expected to create and stop (or cancel) limiters. As goroutines take some time to
+// exit, and the runtime can start short lived ones (GC...), the goroutines are counted
+// several times until there are no more than before fn or a settle timeout expires.
+func AssertNoLeaks(t testing.TB, fn func()) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	fn()
+	after := runtime.NumGoroutine()
+	for deadline := time.Now().Add(settleTimeout); after > before && time.Now().Before(deadline); {
+		time.Sleep(settleInterval)
+		runtime.GC()
+		after = runtime.NumGoroutine()
+	}
+	if after > before {
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Errorf("ratelimittest: %d goroutine(s) leaked (%d before, %d after)\n%s", after-before, before, after, buf)
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimittest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sgaunet/ratelimit"
+)
+
+// recorder is a testing.TB recording the failures instead of failing the test
+type recorder struct {
+	testing.TB
+	failed string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = fmt.Sprintf(format, args...)
+}
+
+func TestAssertNoLeaksWithStoppedLimiters(t *testing.T) {
+	rec := &recorder{TB: t}
+	AssertNoLeaks(rec, func() {
+		for i := 0; i < 10; i++ {
+			r, err := ratelimit.New(context.Background(), time.Second, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Stop()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if _, err := ratelimit.New(ctx, time.Second, 1); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+	})
+	if rec.failed != "" {
+		t.Fatalf("leak reported for stopped limiters: %s", rec.failed)
+	}
+}
+
+func TestAssertNoLeaksDetectsALeak(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	rec := &recorder{TB: t}
+	AssertNoLeaks(rec, func() {
+		go func() { <-release }()
+	})
+	if rec.failed == "" {
+		t.Fatal("leaked goroutine not reported")
+	}
+}
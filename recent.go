@@ -0,0 +1,60 @@
+package ratelimit
+
+import "time"
+
+// recentWindowsSize is the number of past windows kept to compute RecentRate
+const recentWindowsSize = 64
+
+// pastWindow is the number of slots granted during a past window
+type pastWindow struct {
+	count    int
+	duration time.Duration
+}
+
+// recentWindows keeps the counts of the last windows in a ring buffer
+type recentWindows struct {
+	windows []pastWindow
+	next    int
+}
+
+func (w *recentWindows) add(count int, d time.Duration) {
+	if len(w.windows) < recentWindowsSize {
+		w.windows = append(w.windows, pastWindow{count: count, duration: d})
+		return
+	}
+	w.windows[w.next] = pastWindow{count: count, duration: d}
+	w.next = (w.next + 1) % recentWindowsSize
+}
+
+// last returns the last n windows, n is capped to the number of windows kept
+func (w *recentWindows) last(n int) []pastWindow {
+	n = min(n, len(w.windows))
+	res := make([]pastWindow, 0, n)
+	for i := 1; i <= n; i++ {
+		// the newest window is just before next
+		res = append(res, w.windows[(w.next-i+len(w.windows))%len(w.windows)])
+	}
+	return res
+}
+
+// RecentRate returns the achieved rate, in acquisitions per second, over the last
+// windows ended (up to 64), to compare the actual throughput with the limit.
+// It's computed over the windows available if fewer have ended, 0 before the first refill
+// or if windows <= 0.
+func (r *RateLimit) RecentRate(windows int) float64 {
+	if windows <= 0 {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var count int
+	var d time.Duration
+	for _, w := range r.recent.last(windows) {
+		count += w.count
+		d += w.duration
+	}
+	if d <= 0 {
+		return 0
+	}
+	return float64(count) / d.Seconds()
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecentRate(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Second, 10, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.RecentRate(3); got != 0 {
+		t.Fatalf("RecentRate() = %v before the first refill", got)
+	}
+	for i, count := range []int{2, 4, 6} {
+		r.AcquireBatch(count)
+		clock.Advance(time.Second)
+		eventually(t, func() bool {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return len(r.recent.windows) == i+1
+		})
+	}
+	for _, tc := range []struct {
+		windows int
+		want    float64
+	}{{1, 6}, {2, 5}, {3, 4}, {10, 4}, {0, 0}, {-1, 0}} {
+		if got := r.RecentRate(tc.windows); got != tc.want {
+			t.Errorf("RecentRate(%d) = %v, want %v", tc.windows, got, tc.want)
+		}
+	}
+}
+
+func TestRecentWindowsWrap(t *testing.T) {
+	var w recentWindows
+	for i := range recentWindowsSize + 3 {
+		w.add(i, time.Second)
+	}
+	last := w.last(recentWindowsSize + 10)
+	if len(last) != recentWindowsSize || last[0].count != recentWindowsSize+2 || last[len(last)-1].count != 3 {
+		t.Fatalf("last windows from %d to %d, want from %d to 3", last[0].count, last[len(last)-1].count, recentWindowsSize+2)
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reservation is a slot taken by Reserve, it can be given back with Cancel when the
+// work it was taken for turns out to be useless
+type Reservation struct {
+	r   *RateLimit
+	res AcquireResult
+	err error
+
+	mu   sync.Mutex
+	over bool
+}
+
+// Reserve waits for a slot as Wait and returns it as a Reservation, check OK (or Err)
+// before doing the work
+func (r *RateLimit) Reserve() *Reservation {
+	r.setLastCall()
+	res, err := r.acquire(context.Background())
+	return &Reservation{
+		r:   r,
+		res: res,
+		err: err,
+	}
+}
+
+// OK returns true if the slot was granted
+func (rv *Reservation) OK() bool {
+	return rv.err == nil
+}
+
+// Err returns why the slot was not granted (see Wait), nil if it was
+func (rv *Reservation) Err() error {
+	return rv.err
+}
+
+// Commit keeps the slot: the work has been done. Cancel does nothing after Commit.
+func (rv *Reservation) Commit() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.over = true
+}
+
+// Cancel gives the slot back to the limiter so that another call can use it. It does
+// nothing if the slot was not granted, once the slots have been freed since (refill,
+// Reset), after Commit or a previous Cancel, or with a Store (its slots cannot be given back).
+func (rv *Reservation) Cancel() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if rv.over || rv.err != nil || rv.res.grantedAt.IsZero() {
+		return
+	}
+	rv.over = true
+	rv.r.giveBack(rv.res.generation, rv.res.grantedAt)
+}
+
+// giveBack frees a slot granted at grantedAt during generation, if it's still taken
+func (r *RateLimit) giveBack(generation uint64, grantedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation != r.generation {
+		return
+	}
+	now := r.now()
+	switch r.algorithm {
+	case GCRA, LeakyBucket:
+		if r.tat.After(now) {
+			r.tat = r.tat.Add(-r.emissionIntervalLocked())
+		}
+	case TokenBucket:
+		r.tokens, r.tokensAt = min(r.tokensLocked(now)+1, r.bucketCapacity(r.limit)), now
+	case SlidingWindowLog:
+		for i := len(r.callLog) - 1; i >= 0; i-- {
+			if r.callLog[i].Equal(grantedAt) {
+				r.callLog = append(r.callLog[:i], r.callLog[i+1:]...)
+				break
+			}
+		}
+	default:
+		select {
+		case <-r.ch:
+		default:
+		}
+	}
+	for _, t := range r.tiers {
+		// a tier refilled since the grant does not hold the slot anymore
+		if !t.start.After(grantedAt) && t.count > 0 {
+			t.count--
+		}
+	}
+	r.wakeLocked()
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitRefill waits until the background goroutine has refilled the window at the
+// current time of clock
+func waitRefill(t *testing.T, r *RateLimit, clock *fakeClock) {
+	t.Helper()
+	eventually(t, func() bool {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.windowStart.Equal(clock.Now())
+	})
+}
+
+func TestReservationCancelBeforeReset(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	rv := r.Reserve()
+	if !rv.OK() || rv.Err() != nil {
+		t.Fatalf("Reserve() not granted: %v", rv.Err())
+	}
+	r.IsLimitReached()
+	rv.Cancel()
+	if r.Remaining() != 1 {
+		t.Fatalf("Remaining() = %d after Cancel, want 1", r.Remaining())
+	}
+	// a second Cancel does not give back another slot
+	rv.Cancel()
+	if r.Remaining() != 1 {
+		t.Fatalf("Remaining() = %d after a second Cancel, want 1", r.Remaining())
+	}
+	committed := r.Reserve()
+	committed.Commit()
+	committed.Cancel()
+	if r.Remaining() != 0 {
+		t.Fatalf("Remaining() = %d after Commit and Cancel, want 0", r.Remaining())
+	}
+}
+
+func TestReservationCancelAfterReset(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	rv := r.Reserve()
+	r.IsLimitReached()
+	clock.Advance(time.Minute)
+	waitRefill(t, r, clock)
+	r.IsLimitReached()
+	// the slot of rv was freed by the refill, it must not free the one of the new window
+	rv.Cancel()
+	if r.Remaining() != 1 {
+		t.Fatalf("Remaining() = %d after a Cancel across the refill, want 1", r.Remaining())
+	}
+}
+
+func TestReservationOnStoppedLimiter(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+	rv := r.Reserve()
+	if rv.OK() || rv.Err() == nil {
+		t.Fatal("slot reserved on a stopped limiter")
+	}
+	rv.Cancel()
+}
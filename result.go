@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// AcquireResult describes an acquisition, all the values are read at the time the slot
+// was granted (or denied) so they are consistent with each other
+type AcquireResult struct {
+	// Granted is true if a slot has been consumed
+	Granted bool
+	// Remaining is the number of slots left in the window
+	Remaining int
+	// Reset is the time left before the window is refilled
+	Reset time.Duration
+	// Waited is how long the call waited for the slot
+	Waited time.Duration
+	// LimitedBy is the index of the tier without a slot available, the one which denied
+	// the call or made it wait: 0 for the main window (the first tier of NewTiered,
+	// or the store), 1 for the second tier... It's -1 if no tier limited the call:
+	// it was granted at once or denied by Pause or SetGlobalShed.
+	LimitedBy int
+
+	// generation and grantedAt locate the slots granted by the in memory window,
+	// to give them back (see Reservation)
+	generation uint64
+	grantedAt  time.Time
+}
+
+// AcquireContext waits for a slot until ctx or the limiter is done and describes the
+// acquisition, e.g. to set the X-RateLimit-* headers of an HTTP response in one call.
+// When the slot cannot be granted, Granted is false and err tells why.
+func (r *RateLimit) AcquireContext(ctx context.Context) (AcquireResult, error) {
+	r.setLastCall()
+	return r.acquire(ctx)
+}
+
+// TryAcquireInfo consumes a slot if one is available, without waiting, and returns the
+// state of the window read at the same time: on failure, reset is the time to wait
+// before retrying (e.g. for a Retry-After header).
+func (r *RateLimit) TryAcquireInfo() (granted bool, remaining int, reset time.Duration) {
+	r.setLastCall()
+	res := r.tryTake(1)
+	if !res.Granted {
+		r.limitReached()
+		r.overflow("", "limit reached")
+	}
+	return res.Granted, res.Remaining, res.Reset
+}
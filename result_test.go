@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireContextResultIsConsistent(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	clock.Advance(10 * time.Second)
+	for _, want := range []AcquireResult{
+		{Granted: true, Remaining: 1, Reset: 50 * time.Second, LimitedBy: -1},
+		{Granted: true, Remaining: 0, Reset: 50 * time.Second, LimitedBy: -1},
+	} {
+		res, err := r.AcquireContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Granted != want.Granted || res.Remaining != want.Remaining || res.Reset != want.Reset || res.Waited != 0 || res.LimitedBy != want.LimitedBy {
+			t.Fatalf("AcquireContext() = %+v, want %+v", res, want)
+		}
+	}
+	granted, remaining, reset := r.TryAcquireInfo()
+	if granted || remaining != 0 || reset != 50*time.Second {
+		t.Fatalf("TryAcquireInfo() = %v, %d, %v, want false, 0, 50s", granted, remaining, reset)
+	}
+	done := make(chan AcquireResult, 1)
+	go func() {
+		res, err := r.AcquireContext(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		done <- res
+	}()
+	eventually(t, func() bool { return r.Waiters() == 1 && clock.Timers() == 1 })
+	clock.Advance(50 * time.Second)
+	select {
+	case res := <-done:
+		if !res.Granted || res.Remaining != 1 || res.Reset != time.Minute || res.Waited != 50*time.Second || res.LimitedBy != 0 {
+			t.Fatalf("AcquireContext() = %+v after waiting for the refill", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the call is still waiting")
+	}
+}
+
+func TestTryAcquireInfoIsConsistent(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	clock.Advance(20 * time.Second)
+	for _, want := range []struct {
+		granted   bool
+		remaining int
+	}{{true, 1}, {true, 0}, {false, 0}, {false, 0}} {
+		granted, remaining, reset := r.TryAcquireInfo()
+		if granted != want.granted || remaining != want.remaining || reset != 40*time.Second {
+			t.Fatalf("TryAcquireInfo() = %v, %d, %v, want %v, %d, 40s", granted, remaining, reset, want.granted, want.remaining)
+		}
+		if remaining != r.Remaining() || reset != r.TimeUntilReset() {
+			t.Fatal("TryAcquireInfo() does not match the state of the window")
+		}
+	}
+}
+
+func TestLimitedByReportsTheTier(t *testing.T) {
+	clock := newFakeClock()
+	r, err := NewTiered(context.Background(), []Tier{{time.Second, 2}, {time.Minute, 3}}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	res, err := r.AcquireContext(context.Background())
+	if err != nil || res.LimitedBy != -1 {
+		t.Fatalf("AcquireContext() = %+v, %v, want an immediate grant", res, err)
+	}
+	r.IsLimitReached()
+	// the main window is full: the call waits for its refill
+	done := make(chan AcquireResult, 1)
+	go func() {
+		res, _ := r.AcquireContext(context.Background())
+		done <- res
+	}()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	clock.Advance(time.Second)
+	if res := <-done; !res.Granted || res.LimitedBy != 0 {
+		t.Fatalf("AcquireContext() = %+v, want a grant limited by the main window", res)
+	}
+	// the minute tier is full: the call waits for it
+	go func() {
+		res, _ := r.AcquireContext(context.Background())
+		done <- res
+	}()
+	eventually(t, func() bool { return r.Waiters() == 1 && clock.Timers() == 1 })
+	clock.Advance(time.Minute)
+	if res := <-done; !res.Granted || res.LimitedBy != 1 {
+		t.Fatalf("AcquireContext() = %+v, want a grant limited by the second tier", res)
+	}
+	r.Pause()
+	if res := r.tryTake(1); res.Granted || res.LimitedBy != -1 {
+		t.Fatalf("tryTake() = %+v while paused, want a denial by no tier", res)
+	}
+}
+
+func TestLimitedByWithAStore(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1, WithStore(&memStore{taken: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if res := r.tryTake(1); res.Granted || res.LimitedBy != 0 {
+		t.Fatalf("tryTake() = %+v, want a denial by the store", res)
+	}
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import "time"
+
+// TimeUntilReset returns the time left before the window is refilled
+func (r *RateLimit) TimeUntilReset() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.untilResetLocked()
+}
+
+// NextAvailable returns an estimate of the time left before a slot is available, 0 if one
+// is available now: the time until the refill for a saturated fixed window, the time until
+// the next token or call admitted with the other algorithms. It's an estimate: the slot
+// can be taken by another call in the meantime, or freed earlier by SetLimit or Reset.
+func (r *RateLimit) NextAvailable() time.Duration {
+	return r.reserveDelay(1)
+}
+
+// RetryAt returns when a slot will be available, it's the current time if a slot
+// is available now. It can be used for the HTTP-date form of a Retry-After header:
+//
+//	w.Header().Set("Retry-After", r.RetryAt().UTC().Format(http.TimeFormat))
+func (r *RateLimit) RetryAt() time.Time {
+	return r.now().Add(r.NextAvailable())
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+)
+
+// AcquireWithin tries to get a slot without waiting and, if the limit is reached, tries
+// again at each refill of the window (or change of the limit, resume), up to maxAttempts
+// tries in total. It returns ErrLimitReached if all the attempts failed or if ctx is done
+// first (the error then also wraps the error of ctx), ErrStopped if the limiter is stopped.
+func (r *RateLimit) AcquireWithin(ctx context.Context, maxAttempts int) error {
+	r.setLastCall()
+	for attempt := 1; ; attempt++ {
+		// the signals are taken before trying so that a refill or a shed cannot be missed
+		refilled, shed := r.refillSignal(), globalShedSignal()
+		if r.tryTake(1).Granted {
+			return nil
+		}
+		r.limitReached()
+		if attempt >= maxAttempts {
+			r.overflow("", "max attempts reached")
+			return ErrLimitReached
+		}
+		select {
+		case <-shed:
+			r.overflow("", "global shed")
+			return ErrLimitReached
+		case <-refilled:
+		case <-ctx.Done():
+			r.overflow("", "context done")
+			return fmt.Errorf("%w: %w", ErrLimitReached, ctx.Err())
+		case <-r.done:
+			return r.stoppedErr()
+		}
+	}
+}
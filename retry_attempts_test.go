@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireWithinCountsTheAttempts(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	done := make(chan error, 1)
+	go func() { done <- r.AcquireWithin(context.Background(), 3) }()
+	// wake the call twice without freeing any slot: the second and third attempts fail
+	for attempt := uint64(1); attempt <= 3; attempt++ {
+		eventually(t, func() bool { return atomic.LoadUint64(&r.throttled) == attempt })
+		if attempt < 3 {
+			r.mu.Lock()
+			r.wakeLocked()
+			r.mu.Unlock()
+		}
+	}
+	if err := <-done; !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("AcquireWithin() = %v, want ErrLimitReached", err)
+	}
+	// a refill is seen by the next attempt
+	go func() { done <- r.AcquireWithin(context.Background(), 2) }()
+	eventually(t, func() bool { return atomic.LoadUint64(&r.throttled) == 4 })
+	r.ForceRefill()
+	if err := <-done; err != nil {
+		t.Fatalf("AcquireWithin() = %v after a refill", err)
+	}
+}
+
+func TestAcquireWithinCancelled(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.IsLimitReached()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.AcquireWithin(ctx, 10) }()
+	eventually(t, func() bool { return atomic.LoadUint64(&r.throttled) == 1 })
+	cancel()
+	if err := <-done; !errors.Is(err, ErrLimitReached) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("AcquireWithin() = %v, want ErrLimitReached and context.Canceled", err)
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// movableNow is a source of time which can go backwards, as a wall clock adjusted
+type movableNow struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (m *movableNow) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *movableNow) Add(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+func TestNoNegativeDelayWhenTheClockGoesBackwards(t *testing.T) {
+	for _, algorithm := range []Algorithm{FixedWindow, GCRA, TokenBucket, SlidingWindowLog, LeakyBucket} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			clock := &movableNow{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			r, err := New(context.Background(), time.Hour, 2, WithNowFunc(clock.Now), WithAlgorithm(algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			for _, step := range []time.Duration{0, 3 * time.Hour, -5 * time.Hour, time.Minute, -time.Minute} {
+				clock.Add(step)
+				r.IsLimitReached()
+				_, _, reset := r.TryAcquireInfo()
+				if reset < 0 {
+					t.Errorf("after %v: TryAcquireInfo reset = %v", step, reset)
+				}
+				if d := r.TimeUntilReset(); d < 0 {
+					t.Errorf("after %v: TimeUntilReset() = %v", step, d)
+				}
+				if d := r.NextAvailable(); d < 0 {
+					t.Errorf("after %v: NextAvailable() = %v", step, d)
+				}
+				if at := r.RetryAt(); at.Before(clock.Now()) {
+					t.Errorf("after %v: RetryAt() = %v, before now %v", step, at, clock.Now())
+				}
+			}
+			if p50, p90, p99 := r.GrantGaps(); p50 < 0 || p90 < 0 || p99 < 0 {
+				t.Errorf("GrantGaps() = %v %v %v", p50, p90, p99)
+			}
+		})
+	}
+}
+
+func TestRetryAt(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 1, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.RetryAt(); !got.Equal(clock.Now()) {
+		t.Fatalf("RetryAt() = %v with a slot available, want now %v", got, clock.Now())
+	}
+	r.IsLimitReached()
+	clock.Advance(15 * time.Second)
+	retryAt := r.RetryAt()
+	if want := clock.Now().Add(45 * time.Second); !retryAt.Equal(want) {
+		t.Fatalf("RetryAt() = %v, want %v", retryAt, want)
+	}
+	// delta-seconds form
+	if got := strconv.Itoa(int(r.TimeUntilReset().Seconds())); got != "45" {
+		t.Errorf("Retry-After = %s, want 45", got)
+	}
+	// HTTP-date form
+	if got, want := retryAt.UTC().Format(http.TimeFormat), "Wed, 01 Jan 2025 00:01:00 GMT"; got != want {
+		t.Errorf("Retry-After = %s, want %s", got, want)
+	}
+}
+
+func TestNextAvailableDecreasesUntilTheRefill(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.NextAvailable(); got != 0 {
+		t.Fatalf("NextAvailable() = %v with a slot available, want 0", got)
+	}
+	r.IsLimitReached()
+	r.IsLimitReached()
+	prev := time.Minute + 1
+	for range 3 {
+		got := r.NextAvailable()
+		if got <= 0 || got >= prev {
+			t.Fatalf("NextAvailable() = %v, want in (0, %v)", got, prev)
+		}
+		prev = got
+		clock.Advance(15 * time.Second)
+	}
+	if prev != 30*time.Second {
+		t.Fatalf("NextAvailable() = %v 30s into the window, want 30s", prev)
+	}
+}
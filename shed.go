@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// globalShed is 1 while all the limiters shed the calls (see SetGlobalShed)
+	globalShed uint32
+	shedMu     sync.Mutex
+	// shedSignal is closed while shedding, it's replaced when shedding ends
+	shedSignal = make(chan struct{})
+)
+
+// SetGlobalShed makes all the limiters of the process shed the calls while on is true,
+// e.g. to relieve a failing dependency during an incident: no slot is granted,
+// IsLimitReached returns true and the waiting calls return ErrLimitReached at once.
+// It takes precedence over everything else, including Pause and AcquireProbe.
+// It's off by default.
+func SetGlobalShed(on bool) {
+	shedMu.Lock()
+	defer shedMu.Unlock()
+	if isShedding() == on {
+		return
+	}
+	if on {
+		atomic.StoreUint32(&globalShed, 1)
+		close(shedSignal)
+	} else {
+		atomic.StoreUint32(&globalShed, 0)
+		shedSignal = make(chan struct{})
+	}
+}
+
+// isShedding returns true if the calls are shed (see SetGlobalShed)
+func isShedding() bool {
+	return atomic.LoadUint32(&globalShed) == 1
+}
+
+// globalShedSignal returns a channel closed when the calls start to be shed
+func globalShedSignal() <-chan struct{} {
+	shedMu.Lock()
+	defer shedMu.Unlock()
+	return shedSignal
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGlobalShedAffectsAllTheLimiters(t *testing.T) {
+	defer SetGlobalShed(false)
+	var limiters []*RateLimit
+	waiting := make(chan error, 2)
+	for range 2 {
+		r, err := New(context.Background(), time.Hour, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		r.IsLimitReached()
+		go func() { waiting <- r.Wait() }()
+		eventually(t, func() bool { return r.Waiters() == 1 })
+		limiters = append(limiters, r)
+	}
+	SetGlobalShed(true)
+	for range 2 {
+		if err := <-waiting; !errors.Is(err, ErrLimitReached) {
+			t.Fatalf("Wait() = %v while shedding, want ErrLimitReached", err)
+		}
+	}
+	for i, r := range limiters {
+		r.Reset()
+		if !r.IsLimitReached() {
+			t.Fatalf("limiter %d granted a slot while shedding", i)
+		}
+	}
+	SetGlobalShed(false)
+	for i, r := range limiters {
+		if r.IsLimitReached() {
+			t.Fatalf("limiter %d still shedding", i)
+		}
+	}
+}
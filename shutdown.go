@@ -0,0 +1,43 @@
+package ratelimit
+
+import "context"
+
+// Shutdown stops the limiter gracefully: the new calls are refused (IsLimitReached
+// returns true, the acquisitions return ErrStopped) while the calls already waiting
+// keep being served. It returns nil once no call is waiting, or the error of ctx if
+// ctx is done first, and stops the limiter as Stop in both cases.
+func (r *RateLimit) Shutdown(ctx context.Context) error {
+	r.drainOnce.Do(func() {
+		close(r.draining)
+		r.log.Debug("Draining", "waiters", r.Waiters())
+	})
+	defer r.Stop()
+	if r.Waiters() == 0 {
+		r.signalDrained()
+		return nil
+	}
+	// signaled by the last waiting call
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.done:
+		return nil
+	case <-r.drained:
+		return nil
+	}
+}
+
+// signalDrained tells Shutdown that no call is waiting anymore
+func (r *RateLimit) signalDrained() {
+	r.drainedOnce.Do(func() { close(r.drained) })
+}
+
+// isDraining returns true once Shutdown has been called
+func (r *RateLimit) isDraining() bool {
+	select {
+	case <-r.draining:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForTheWaitingCalls(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 2, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AcquireRemaining()
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() { errs <- r.Wait() }()
+	}
+	eventually(t, func() bool { return r.Waiters() == 2 })
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- r.Shutdown(context.Background()) }()
+	eventually(t, r.isDraining)
+	if !r.IsLimitReached() {
+		t.Fatal("new call admitted while draining")
+	}
+	if err := r.Wait(); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Wait() while draining = %v, want ErrStopped", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() = %v with calls waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("waiting call = %v, want its slot", err)
+		}
+	}
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("Shutdown() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown not returned once the calls were served")
+	}
+	select {
+	case <-r.done:
+	default:
+		t.Fatal("limiter not stopped by Shutdown")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.IsLimitReached()
+	errs := make(chan error, 1)
+	go func() { errs <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want DeadlineExceeded", err)
+	}
+	if err := <-errs; !errors.Is(err, ErrStopped) {
+		t.Fatalf("waiting call = %v after the deadline, want ErrStopped", err)
+	}
+}
+
+func TestShutdownWithoutWaitingCalls(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v with no call waiting, want nil", err)
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second Shutdown() = %v, want nil", err)
+	}
+}
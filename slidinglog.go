@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// logStartLocked returns the index of the first call of the log in the trailing window
+// ending at now, r.mu must be held
+func (r *RateLimit) logStartLocked(now time.Time) int {
+	since := now.Add(-r.d)
+	return sort.Search(len(r.callLog), func(i int) bool {
+		return r.callLog[i].After(since)
+	})
+}
+
+// logAvailableLocked returns the number of calls admitted now: limit minus the calls of
+// the trailing window, r.mu must be held
+func (r *RateLimit) logAvailableLocked(now time.Time) int {
+	return max(r.limit-(len(r.callLog)-r.logStartLocked(now)), 0)
+}
+
+// logConsumeLocked prunes the calls out of the trailing window and adds n calls at now,
+// r.mu must be held for writing
+func (r *RateLimit) logConsumeLocked(n int, now time.Time) {
+	r.callLog = r.callLog[r.logStartLocked(now):]
+	for i := 0; i < n; i++ {
+		r.callLog = append(r.callLog, now)
+	}
+}
+
+// logDelayLocked returns how long to wait before n calls are admitted: until enough
+// of the oldest calls of the trailing window leave it, r.mu must be held. More than
+// limit calls are never admitted at once (e.g. after SetLimit), the delay is then the
+// longest one.
+func (r *RateLimit) logDelayLocked(now time.Time, n int) time.Duration {
+	if n > r.limit {
+		return math.MaxInt64
+	}
+	start := r.logStartLocked(now)
+	leaving := len(r.callLog) - start + n - r.limit
+	if leaving <= 0 {
+		return 0
+	}
+	return nonNegative(r.callLog[start+leaving-1].Add(r.d).Sub(now))
+}
+
+// logFreeDelayLocked returns how long to wait before the trailing window holds no call,
+// r.mu must be held
+func (r *RateLimit) logFreeDelayLocked(now time.Time) time.Duration {
+	if len(r.callLog) == 0 {
+		return 0
+	}
+	return nonNegative(r.callLog[len(r.callLog)-1].Add(r.d).Sub(now))
+}
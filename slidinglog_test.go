@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowLogNeverExceedsTheLimit(t *testing.T) {
+	const d, limit = 10 * time.Second, 5
+	clock := newFakeClock()
+	r, err := New(context.Background(), d, limit, WithClock(clock), WithAlgorithm(SlidingWindowLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	rnd := rand.New(rand.NewPCG(1, 2))
+	var admitted []time.Time
+	for range 500 {
+		clock.Advance(time.Duration(rnd.IntN(3000)) * time.Millisecond)
+		for range rnd.IntN(4) {
+			if !r.IsLimitReached() {
+				admitted = append(admitted, clock.Now())
+			}
+		}
+		r.mu.RLock()
+		logged := len(r.callLog)
+		r.mu.RUnlock()
+		if logged > limit {
+			t.Fatalf("%d calls kept in the log", logged)
+		}
+	}
+	if len(admitted) < 100 {
+		t.Fatalf("only %d calls admitted", len(admitted))
+	}
+	// the trailing window (t-d, t] of each admission, across the refills of the ticker
+	for i, at := range admitted {
+		n := 0
+		for j := i; j >= 0 && admitted[j].After(at.Add(-d)); j-- {
+			n++
+		}
+		if n > limit {
+			t.Fatalf("%d calls admitted in the %v before %v", n, d, at)
+		}
+	}
+}
+
+func TestSlidingWindowLogDelayOverTheLimit(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3, WithAlgorithm(SlidingWindowLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for range 3 {
+		r.IsLimitReached()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the limit can be lowered below the calls of a waiting call
+	if got := r.logDelayLocked(r.now(), 5); got != math.MaxInt64 {
+		t.Fatalf("delay of 5 calls with a limit of 3 = %v, want the longest one", got)
+	}
+}
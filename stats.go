@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the state of a RateLimit
+type Stats struct {
+	Limit          int           `json:"limit"`
+	InUse          int           `json:"in_use"`
+	Remaining      int           `json:"remaining"`
+	LastCall       time.Time     `json:"last_call"`
+	WindowDuration time.Duration `json:"window_duration"`
+	// Acquired is the number of slots granted since New
+	Acquired uint64 `json:"acquired"`
+	// Throttled is the number of calls which reached the limit since New
+	Throttled uint64 `json:"throttled"`
+	// BlockedRatio is the fraction of acquisitions which had to wait (see BlockedRatio)
+	BlockedRatio float64 `json:"blocked_ratio"`
+}
+
+// Stats returns a snapshot of the limiter, all the values are read at once:
+// Remaining is the value returned by Remaining and InUse is Limit - Remaining.
+func (r *RateLimit) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := r.remainingLocked(r.now())
+	return Stats{
+		Limit:          r.limit,
+		InUse:          max(r.limit-remaining, 0),
+		Remaining:      remaining,
+		LastCall:       r.lastCall,
+		WindowDuration: r.d,
+		Acquired:       atomic.LoadUint64(&r.acquired),
+		Throttled:      atomic.LoadUint64(&r.throttled),
+		BlockedRatio:   r.BlockedRatio(),
+	}
+}
+
+// Rate returns the rate allowed, in calls per second: limit/d of the main window
+// (see SetLimit and SetDuration), to compare with RecentRate
+func (r *RateLimit) Rate() float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return float64(r.limit) / r.d.Seconds()
+}
+
+// String describes the limiter for the logs, e.g.
+// ratelimit(limit=20 per 1s, inUse=5, algorithm=fixed_window), with its name if set
+func (r *RateLimit) String() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var name string
+	if r.name != "" {
+		name = "name=" + r.name + ", "
+	}
+	inUse := max(r.limit-r.availableLocked(r.now()), 0)
+	return fmt.Sprintf("ratelimit(%slimit=%d per %v, inUse=%d, algorithm=%v)", name, r.limit, r.d, inUse, r.algorithm)
+}
+
+// BlockedRatio returns the fraction of the acquisitions which had to wait for a slot,
+// over the current and the previous windows. A ratio close to 1 means that the limit is
+// too low for the load. It's 0 when there was no acquisition.
+func (r *RateLimit) BlockedRatio() float64 {
+	// summed as floats, the sums of the counters could wrap around
+	immediate := float64(atomic.LoadUint64(&r.immediate)) + float64(atomic.LoadUint64(&r.prevImmediate))
+	blocked := float64(atomic.LoadUint64(&r.blocked)) + float64(atomic.LoadUint64(&r.prevBlocked))
+	if immediate+blocked == 0 {
+		return 0
+	}
+	return blocked / (immediate + blocked)
+}
+
+// BlockedCount returns the number of acquisitions which could not get a slot at once
+// since New: they waited for it, or failed. See TotalCount.
+func (r *RateLimit) BlockedCount() uint64 {
+	return atomic.LoadUint64(&r.blockedTotal)
+}
+
+// TotalCount returns the number of acquisitions which wait for a slot if needed
+// (WaitIfLimitReached, WaitContext, AcquireN...) since New, blocked or not
+func (r *RateLimit) TotalCount() uint64 {
+	return atomic.LoadUint64(&r.attempts)
+}
+
+// IsSaturated returns true if all the slots of the window are used, so that a call
+// would have to wait. Unlike IsLimitReached, it never consumes a slot.
+func (r *RateLimit) IsSaturated() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	return r.availableLocked(now) == 0 || r.tiersDelayLocked(now, 1) > 0
+}
+
+// Remaining returns the number of calls allowed before blocking in the current window.
+// It only reflects the current window: it jumps back to the limit at the next refill.
+func (r *RateLimit) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remainingLocked(r.now())
+}
+
+// Peek returns true if a call would get a slot now, as Allow, without consuming it.
+// It's only a hint: the slot can be taken by another call before the next one.
+func (r *RateLimit) Peek() bool {
+	select {
+	case <-r.done:
+		// stopped, it no longer limits
+		return true
+	default:
+	}
+	if isShedding() || r.isDraining() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused || r.claim != nil {
+		return false
+	}
+	if r.store != nil {
+		// the store cannot be read without taking a slot, only the local state is known
+		return true
+	}
+	return r.remainingLocked(r.now()) > 0
+}
+
+// remainingLocked returns the number of calls allowed now in all the tiers,
+// r.mu must be held for writing
+func (r *RateLimit) remainingLocked(now time.Time) int {
+	r.tiersAvailableLocked(now) // refills the expired tiers
+	return max(r.tiersRemainingLocked(r.availableLocked(now)), 0)
+}
@@ -0,0 +1,247 @@
+package ratelimit
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBlockedRatioOfAKnownMix(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 3, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	check := func(want float64) {
+		t.Helper()
+		if got := r.BlockedRatio(); got != want {
+			t.Fatalf("BlockedRatio() = %v, want %v", got, want)
+		}
+		if got := r.Stats().BlockedRatio; got != want {
+			t.Fatalf("Stats().BlockedRatio = %v, want %v", got, want)
+		}
+	}
+	check(0)
+	for range 3 {
+		if err := r.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(0)
+	// a fourth call waits for the next window
+	done := make(chan error, 1)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	check(1.0 / 4)
+	for range 2 {
+		if err := r.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(1.0 / 6)
+	// the first window is forgotten, then the second one
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.BlockedRatio() == 1.0/3 })
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.BlockedRatio() == 0 })
+}
+
+func TestIsSaturatedAroundTheLimit(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for i := range 3 {
+		if r.IsSaturated() {
+			t.Fatalf("saturated with %d slots used out of 3", i)
+		}
+		r.IsLimitReached()
+	}
+	for range 2 {
+		// checking does not consume anything
+		if !r.IsSaturated() {
+			t.Fatal("not saturated with the 3 slots used")
+		}
+	}
+	r.Reset()
+	if r.IsSaturated() || r.Remaining() != 3 {
+		t.Fatal("saturated after Reset")
+	}
+}
+
+func TestRemainingDecreasesAndResets(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 5, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for want := 4; want >= 0; want-- {
+		r.IsLimitReached()
+		if got := r.Remaining(); got != want {
+			t.Fatalf("Remaining() = %d, want %d", got, want)
+		}
+	}
+	r.IsLimitReached()
+	if got := r.Remaining(); got != 0 {
+		t.Fatalf("Remaining() = %d when denied, want 0", got)
+	}
+	clock.Advance(time.Minute)
+	eventually(t, func() bool { return r.Remaining() == 5 })
+}
+
+func TestStatsConsistentWithConcurrentAcquires(t *testing.T) {
+	r, err := New(context.Background(), MinDuration, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				r.IsLimitReached()
+				if i == 0 {
+					_ = r.SetLimit(20 + rand.IntN(60))
+				}
+			}
+		}()
+	}
+	for ctx.Err() == nil {
+		st := r.Stats()
+		if st.InUse+st.Remaining != st.Limit || st.Remaining < 0 || st.WindowDuration != MinDuration {
+			t.Fatalf("inconsistent snapshot %+v", st)
+		}
+	}
+	wg.Wait()
+}
+
+func TestBlockedAndTotalCounts(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if r.TryAcquire(time.Millisecond) {
+			t.Fatal("slot granted beyond the limit")
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- r.Wait() }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	r.Reset()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if blocked, total := r.BlockedCount(), r.TotalCount(); blocked != 4 || total != 5 {
+		t.Fatalf("BlockedCount() = %d, TotalCount() = %d, want 4 and 5", blocked, total)
+	}
+}
+
+func TestPeekDoesNotConsume(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for range 3 {
+		if !r.Peek() || r.Remaining() != 2 {
+			t.Fatalf("Peek() consumed a slot, %d remaining", r.Remaining())
+		}
+	}
+	r.Allow()
+	r.Allow()
+	if r.Peek() || r.Remaining() != 0 {
+		t.Fatal("Peek() = true with no slot left")
+	}
+	r.Pause()
+	r.Reset()
+	if r.Peek() {
+		t.Fatal("Peek() = true while paused")
+	}
+}
+
+func TestRate(t *testing.T) {
+	for _, tc := range []struct {
+		d     time.Duration
+		limit int
+		want  float64
+	}{
+		{time.Second, 20, 20},
+		{time.Minute, 30, 0.5},
+		{100 * time.Millisecond, 1, 10},
+		{time.Hour, 90, 0.025},
+	} {
+		r, err := New(context.Background(), tc.d, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Rate(); got != tc.want {
+			t.Errorf("%d per %v: Rate() = %v, want %v", tc.limit, tc.d, got, tc.want)
+		}
+		r.Stop()
+	}
+	r, err := New(context.Background(), time.Second, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.SetLimit(5); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Rate(); got != 5 {
+		t.Fatalf("Rate() = %v after SetLimit(5), want 5", got)
+	}
+	if err := r.SetDuration(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Rate(); got != 2.5 {
+		t.Fatalf("Rate() = %v after SetDuration(2s), want 2.5", got)
+	}
+}
+
+func TestString(t *testing.T) {
+	clock := newFakeClock()
+	descriptions := make(chan string, 1)
+	var r *RateLimit
+	r, err := New(context.Background(), time.Second, 20, WithClock(clock), WithName("api"), WithOnWindowEnd(func(int, time.Time, time.Time) {
+		// no lock is held by the callbacks
+		descriptions <- r.String()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for range 5 {
+		r.IsLimitReached()
+	}
+	if got, want := r.String(), "ratelimit(name=api, limit=20 per 1s, inUse=5, algorithm=fixed_window)"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	clock.Advance(time.Second)
+	select {
+	case got := <-descriptions:
+		if !strings.Contains(got, "limit=20 per 1s") {
+			t.Fatalf("String() = %q in the callback", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("String() blocked in the callback")
+	}
+}
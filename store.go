@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store shares the windows of limiters between several processes (e.g. with Redis)
+type Store interface {
+	// Take consumes a slot of the current window, it returns false if limit slots
+	// have already been consumed during the window. ctx is cancelled when the
+	// limiter is stopped.
+	Take(ctx context.Context, limit int, window time.Duration) (bool, error)
+}
+
+// StoreFallback is the policy applied when the Store returns an error
+type StoreFallback int
+
+const (
+	// FallbackLocal applies the limit with the in memory window of the limiter
+	FallbackLocal StoreFallback = iota
+	// FallbackOpen allows the call
+	FallbackOpen
+	// FallbackClosed denies the call
+	FallbackClosed
+)
+
+// WithStore makes the limiter consume the slots from s instead of its in memory window
+func WithStore(s Store) Option {
+	return func(r *RateLimit) {
+		r.store = s
+	}
+}
+
+// WithStoreFallback sets the policy applied when the store is unavailable,
+// FallbackLocal is used by default
+func WithStoreFallback(policy StoreFallback) Option {
+	return func(r *RateLimit) {
+		r.storeFallback = policy
+	}
+}
+
+// takeFromStore consumes a slot from the store and applies the fallback policy on error
+func (r *RateLimit) takeFromStore() bool {
+	r.mu.RLock()
+	limit, d, paused := r.limit, r.d, r.paused
+	r.mu.RUnlock()
+	if paused {
+		return false
+	}
+	ok, err := r.store.Take(r.stopCtx, limit, d)
+	if err == nil {
+		return ok
+	}
+	if r.storeLog.allow(r.now()) {
+		r.log.Warn("Store unavailable", "err", err)
+	}
+	switch r.storeFallback {
+	case FallbackOpen:
+		return true
+	case FallbackClosed:
+		return false
+	default:
+		return r.takeLocal(1, nil).Granted
+	}
+}
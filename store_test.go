@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a Store counting the slots taken per window, it fails while err is set
+type memStore struct {
+	mu    sync.Mutex
+	taken int
+	err   error
+}
+
+func (s *memStore) Take(_ context.Context, limit int, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	if s.taken >= limit {
+		return false, nil
+	}
+	s.taken++
+	return true, nil
+}
+
+func (s *memStore) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func TestStoreIsUsed(t *testing.T) {
+	store := &memStore{}
+	r, err := New(context.Background(), time.Hour, 2, WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if r.IsLimitReached() || r.IsLimitReached() {
+		t.Fatal("limit reached before 2 calls")
+	}
+	if !r.IsLimitReached() {
+		t.Fatal("limit not reached after 2 calls")
+	}
+	if store.taken != 2 {
+		t.Fatalf("%d slots taken from the store, want 2", store.taken)
+	}
+}
+
+func TestStoreFallback(t *testing.T) {
+	errDown := errors.New("store down")
+	for _, tc := range []struct {
+		policy StoreFallback
+		// granted is the number of calls granted out of 5 while the store is down
+		granted int
+	}{
+		{FallbackLocal, 2},
+		{FallbackOpen, 5},
+		{FallbackClosed, 0},
+	} {
+		store := &memStore{err: errDown}
+		r, err := New(context.Background(), time.Hour, 2, WithStore(store), WithStoreFallback(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		granted := 0
+		for i := 0; i < 5; i++ {
+			if !r.IsLimitReached() {
+				granted++
+			}
+		}
+		if granted != tc.granted {
+			t.Errorf("policy %d: %d calls granted while the store is down, want %d", tc.policy, granted, tc.granted)
+		}
+		// back to the store once it's available again
+		store.setErr(nil)
+		if r.IsLimitReached() {
+			t.Errorf("policy %d: limit reached once the store is back", tc.policy)
+		}
+		r.Stop()
+	}
+}
+
+// blockingStore is a Store whose Take blocks until its context is cancelled
+type blockingStore struct {
+	called chan struct{}
+}
+
+func (s blockingStore) Take(ctx context.Context, _ int, _ time.Duration) (bool, error) {
+	close(s.called)
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestStopCancelsTheStoreCall(t *testing.T) {
+	store := blockingStore{called: make(chan struct{})}
+	r, err := New(context.Background(), time.Hour, 1, WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	returned := make(chan struct{})
+	go func() {
+		r.IsLimitReached()
+		close(returned)
+	}()
+	<-store.called
+	r.Stop()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("call to the store not cancelled by Stop")
+	}
+}
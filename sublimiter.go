@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// SubLimiter shares the window of its parent RateLimit but can be stopped on its own:
+// stopping it does not stop the parent. It's useful to give a limiter to a component
+// which may call Stop.
+type SubLimiter struct {
+	parent *RateLimit
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ Limiter = (*SubLimiter)(nil)
+
+// SubLimiter returns a handle consuming the slots of r which can be stopped without
+// stopping r
+func (r *RateLimit) SubLimiter() *SubLimiter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SubLimiter{
+		parent: r,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// WaitIfLimitReached waits for a slot of the parent, it returns immediately once the
+// sub limiter or the parent is stopped
+func (s *SubLimiter) WaitIfLimitReached() {
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.parent.setLastCall()
+	if _, err := s.parent.acquire(s.ctx); err != nil {
+		s.parent.log.Debug("End SubLimiter.WaitIfLimitReached")
+	}
+}
+
+// IsLimitReached consumes a slot of the parent if one is available and returns false,
+// it returns true otherwise. It returns false once the sub limiter is stopped.
+func (s *SubLimiter) IsLimitReached() bool {
+	if s.ctx.Err() != nil {
+		return false
+	}
+	return s.parent.IsLimitReached()
+}
+
+// TryAcquire waits up to timeout for a slot of the parent and returns true if it got one,
+// it returns false once the sub limiter is stopped
+func (s *SubLimiter) TryAcquire(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	s.parent.setLastCall()
+	_, err := s.parent.acquire(ctx)
+	return err == nil
+}
+
+// WaitContext waits for a slot of the parent until ctx is done, as RateLimit.WaitContext.
+// It returns ErrStopped once the sub limiter is stopped, even while waiting.
+func (s *SubLimiter) WaitContext(ctx context.Context) error {
+	if s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+	s.parent.setLastCall()
+	_, err := s.parent.acquire(waitCtx)
+	if err != nil && ctx.Err() == nil && s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	return err
+}
+
+// GetLastCall returns the time of the last call to the parent (through any handle)
+func (s *SubLimiter) GetLastCall() time.Time {
+	return s.parent.GetLastCall()
+}
+
+// Stop stops the sub limiter only, the parent keeps working
+func (s *SubLimiter) Stop() {
+	s.cancel()
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoppingTheSubLimiterLeavesTheParent(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	sub := r.SubLimiter()
+	if sub.IsLimitReached() || r.Remaining() != 2 {
+		t.Fatal("the sub limiter does not share the window of its parent")
+	}
+	r.IsLimitReached()
+	r.IsLimitReached()
+	done := make(chan error, 1)
+	go func() { done <- sub.WaitContext(context.Background()) }()
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	sub.Stop()
+	if err := <-done; !errors.Is(err, ErrStopped) {
+		t.Fatalf("WaitContext() = %v after Stop, want ErrStopped", err)
+	}
+	select {
+	case <-r.done:
+		t.Fatal("the parent was stopped")
+	default:
+	}
+	r.Reset()
+	if r.IsLimitReached() {
+		t.Fatal("the parent does not work after the sub limiter was stopped")
+	}
+	if sub.IsLimitReached() || r.Remaining() != 2 {
+		t.Fatal("the stopped sub limiter consumed a slot")
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import "context"
+
+// Result is a value produced by the generator given to Throttle, or its error
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Throttle calls gen at the rate of r and sends the values on the returned channel, e.g.
+// to crawl a paginated API. gen returns the next value, false when there are no more
+// values (the value is then ignored), or an error which is sent as the last result.
+// If ctx is done or r is stopped, the error is sent (unless nobody reads the channel
+// anymore) and the generation stops. The channel is closed at the end.
+func Throttle[T any](ctx context.Context, r *RateLimit, gen func() (T, bool, error)) <-chan Result[T] {
+	results := make(chan Result[T])
+	go func() {
+		defer close(results)
+		send := func(res Result[T]) bool {
+			select {
+			case results <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			r.setLastCall()
+			if _, err := r.acquire(ctx); err != nil {
+				send(Result[T]{Err: err})
+				return
+			}
+			v, more, err := gen()
+			if err != nil {
+				send(Result[T]{Err: err})
+				return
+			}
+			if !more || !send(Result[T]{Value: v}) {
+				return
+			}
+		}
+	}()
+	return results
+}
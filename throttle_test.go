@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pages returns a generator of n values, failing with err after them if not nil
+func pages(n int, err error) func() (int, bool, error) {
+	next := 0
+	return func() (int, bool, error) {
+		if next == n {
+			return 0, false, err
+		}
+		next++
+		return next, true, nil
+	}
+}
+
+func TestThrottleFiniteGenerator(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 3, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	results := Throttle(context.Background(), r, pages(5, nil))
+	for want := 1; want <= 5; want++ {
+		if want == 4 {
+			// the window is used, the next values wait for the refill
+			eventually(t, func() bool { return r.Waiters() == 1 })
+			clock.Advance(time.Minute)
+		}
+		res, ok := <-results
+		if !ok || res.Err != nil || res.Value != want {
+			t.Fatalf("result %+v, %v, want the value %d", res, ok, want)
+		}
+	}
+	if res, ok := <-results; ok {
+		t.Fatalf("result %+v after the last value", res)
+	}
+}
+
+func TestThrottleGeneratorError(t *testing.T) {
+	r, err := New(context.Background(), time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	errPage := errors.New("page not found")
+	var got []Result[int]
+	for res := range Throttle(context.Background(), r, pages(2, errPage)) {
+		got = append(got, res)
+	}
+	if len(got) != 3 || got[0].Value != 1 || got[1].Value != 2 || !errors.Is(got[2].Err, errPage) {
+		t.Fatalf("results %+v, want 1, 2 then the error", got)
+	}
+}
+
+func TestThrottleCancelledMidStream(t *testing.T) {
+	r, err := New(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	results := Throttle(ctx, r, pages(10, nil))
+	for want := 1; want <= 2; want++ {
+		if res := <-results; res.Value != want {
+			t.Fatalf("result %+v, want the value %d", res, want)
+		}
+	}
+	eventually(t, func() bool { return r.Waiters() == 1 })
+	cancel()
+	select {
+	case res, ok := <-results:
+		if ok && !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("result %+v after the cancellation", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the generation did not stop")
+	}
+	for range results {
+		// drained until closed
+	}
+}
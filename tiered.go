@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Tier is a limit of calls per duration
+type Tier struct {
+	Duration time.Duration
+	Limit    int
+}
+
+// tier is an additional window of a tiered limiter, it's refilled lazily
+type tier struct {
+	Tier
+	start time.Time
+	count int
+}
+
+// NewTiered returns a RateLimit enforcing all the tiers at once, e.g. 10 calls per second
+// and 100 calls per minute. A slot is granted only if every tier has one available.
+// The first tier is the main window of the limiter (refilled by the background goroutine,
+// changed by SetLimit and reported by Stats), the others are refilled when they are used.
+func NewTiered(ctx context.Context, tiers []Tier, opts ...Option) (*RateLimit, error) {
+	if len(tiers) == 0 {
+		return nil, ErrInvalidParams
+	}
+	extra := make([]*tier, 0, len(tiers)-1)
+	for _, t := range tiers[1:] {
+		if t.Limit <= 0 || t.Duration <= 0 {
+			return nil, ErrInvalidParams
+		}
+		extra = append(extra, &tier{Tier: t})
+	}
+	opts = append(opts, func(r *RateLimit) {
+		r.tiers = extra
+	})
+	return New(ctx, tiers[0].Duration, tiers[0].Limit, opts...)
+}
+
+// tiersAvailableLocked refills the expired tiers and returns true if they all have
+// a slot available, r.mu must be held for writing
+func (r *RateLimit) tiersAvailableLocked(now time.Time) bool {
+	available := true
+	for _, t := range r.tiers {
+		if t.start.IsZero() {
+			t.start = now
+		}
+		if elapsed := now.Sub(t.start); elapsed >= t.Duration {
+			// keep the phase of the window
+			t.start = t.start.Add(elapsed - elapsed%t.Duration)
+			t.count = 0
+		}
+		if t.count >= t.Limit {
+			available = false
+		}
+	}
+	return available
+}
+
+// limitingTierLocked returns the index of the first tier without n slots available,
+// 0 being the main window, or -1 if they all have them. The expired tiers must have
+// been refilled, r.mu must be held.
+func (r *RateLimit) limitingTierLocked(now time.Time, n int) int {
+	if r.availableLocked(now) < n {
+		return 0
+	}
+	for i, t := range r.tiers {
+		if t.Limit-t.count < n {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// tiersConsumeLocked consumes n slots of each tier, r.mu must be held for writing
+func (r *RateLimit) tiersConsumeLocked(n int) {
+	for _, t := range r.tiers {
+		t.count += n
+	}
+}
+
+// tiersRemainingLocked returns the smallest number of slots left among remaining
+// (the one of the main window) and the tiers, r.mu must be held
+func (r *RateLimit) tiersRemainingLocked(remaining int) int {
+	for _, t := range r.tiers {
+		if left := t.Limit - t.count; left < remaining {
+			remaining = left
+		}
+	}
+	return remaining
+}
+
+// tiersDelayLocked returns how long to wait before all the tiers have n slots available,
+// r.mu must be held
+func (r *RateLimit) tiersDelayLocked(now time.Time, n int) time.Duration {
+	var d time.Duration
+	for _, t := range r.tiers {
+		if t.Limit-t.count >= n {
+			continue
+		}
+		if td := nonNegative(t.start.Add(t.Duration).Sub(now)); td > d {
+			d = td
+		}
+	}
+	return d
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTieredEnforcesEveryTier(t *testing.T) {
+	clock := newFakeClock()
+	r, err := NewTiered(context.Background(), []Tier{{time.Second, 2}, {time.Minute, 5}}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	advance := func(d time.Duration) {
+		clock.Advance(d)
+		eventually(t, func() bool {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.windowStart.Equal(clock.Now())
+		})
+	}
+	// the second-long tier limits the burst, then the minute-long one the sustained rate
+	for i, step := range []struct {
+		granted   int
+		limitedBy int
+	}{{2, 0}, {2, 0}, {1, 1}, {0, 1}} {
+		for range step.granted {
+			if res := r.tryTake(1); !res.Granted {
+				t.Fatalf("step %d: slot denied, %d remaining", i, r.Remaining())
+			}
+		}
+		if res := r.tryTake(1); res.Granted || res.LimitedBy != step.limitedBy {
+			t.Fatalf("step %d: got %+v, want a denial by tier %d", i, res, step.limitedBy)
+		}
+		advance(time.Second)
+	}
+	advance(time.Minute - 4*time.Second)
+	if !r.Allow() || !r.Allow() || r.Allow() {
+		t.Fatal("want 2 slots once the minute is over")
+	}
+}
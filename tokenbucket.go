@@ -0,0 +1,71 @@
+package ratelimit
+
+import "time"
+
+// WithBurst sets the number of tokens the bucket can hold with TokenBucket (limit by
+// default): up to b calls are admitted at once after an idle time, while the bucket is
+// still refilled at limit per d. New returns ErrInvalidParams if b < 1 or if the
+// algorithm is not TokenBucket.
+func WithBurst(b int) Option {
+	return func(r *RateLimit) {
+		r.burst = b
+		r.burstSet = true
+	}
+}
+
+// bucketCapacity returns the number of tokens the bucket can hold for a limit,
+// r.mu must be held
+func (r *RateLimit) bucketCapacity(limit int) float64 {
+	if r.burstSet {
+		return float64(r.burst)
+	}
+	return float64(limit)
+}
+
+// tokensLocked returns the number of tokens in the bucket now, r.mu must be held
+func (r *RateLimit) tokensLocked(now time.Time) float64 {
+	capacity := r.bucketCapacity(r.limit)
+	if r.tokensAt.IsZero() {
+		// the bucket starts full
+		return capacity
+	}
+	rate := float64(r.limit) / r.d.Seconds()
+	return min(capacity, r.tokens+nonNegative(now.Sub(r.tokensAt)).Seconds()*rate)
+}
+
+// bucketAvailableLocked returns the number of whole tokens in the bucket, r.mu must be held
+func (r *RateLimit) bucketAvailableLocked(now time.Time) int {
+	return int(r.tokensLocked(now))
+}
+
+// bucketConsumeLocked takes n tokens from the bucket, r.mu must be held for writing
+func (r *RateLimit) bucketConsumeLocked(n int, now time.Time) {
+	r.tokens = r.tokensLocked(now) - float64(n)
+	r.tokensAt = now
+}
+
+// bucketDelayLocked returns how long to wait before the bucket holds n tokens, r.mu must be held
+func (r *RateLimit) bucketDelayLocked(now time.Time, n int) time.Duration {
+	return r.tokensDelayLocked(now, float64(n))
+}
+
+// bucketFullDelayLocked returns how long to wait before the bucket is full, r.mu must be held
+func (r *RateLimit) bucketFullDelayLocked(now time.Time) time.Duration {
+	return r.tokensDelayLocked(now, r.bucketCapacity(r.limit))
+}
+
+// tokensDelayLocked returns how long to wait before the bucket holds n tokens, r.mu must be held
+func (r *RateLimit) tokensDelayLocked(now time.Time, n float64) time.Duration {
+	missing := n - r.tokensLocked(now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * float64(r.d) / float64(r.limit))
+}
+
+// bucketSetLimitLocked keeps the same ratio of tokens in the bucket when the limit
+// changes to limit, r.mu must be held for writing
+func (r *RateLimit) bucketSetLimitLocked(limit int, now time.Time) {
+	r.tokens = r.tokensLocked(now) * r.bucketCapacity(limit) / r.bucketCapacity(r.limit)
+	r.tokensAt = now
+}
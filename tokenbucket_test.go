@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// admittedAround returns how many calls are admitted in the 2 seconds around the refill
+// of the fixed window, with a limit of 10 per minute
+func admittedAround(t *testing.T, algorithm Algorithm) int {
+	t.Helper()
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 10, WithClock(clock), WithAlgorithm(algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	clock.Advance(59 * time.Second)
+	got := r.AcquireRemaining()
+	clock.Advance(time.Second)
+	eventually(t, func() bool {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.windowStart.Equal(clock.Now())
+	})
+	clock.Advance(time.Second)
+	return got + r.AcquireRemaining()
+}
+
+func TestTokenBucketIsSmootherThanTheFixedWindow(t *testing.T) {
+	if got := admittedAround(t, FixedWindow); got != 20 {
+		t.Fatalf("fixed window: %d calls admitted around the refill, want 20", got)
+	}
+	if got := admittedAround(t, TokenBucket); got != 10 {
+		t.Fatalf("token bucket: %d calls admitted around the refill, want 10", got)
+	}
+}
+
+func TestTokenBucketRefillsContinuously(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Minute, 10, WithClock(clock), WithAlgorithm(TokenBucket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.AcquireRemaining()
+	// a token every 6s
+	for range 3 {
+		clock.Advance(6*time.Second - time.Millisecond)
+		if !r.IsLimitReached() {
+			t.Fatal("token granted before it was refilled")
+		}
+		clock.Advance(time.Millisecond)
+		if r.IsLimitReached() {
+			t.Fatal("token not refilled after 6s")
+		}
+	}
+}
+
+func TestBurstThenBaseRate(t *testing.T) {
+	clock := newFakeClock()
+	r, err := New(context.Background(), time.Second, 1, WithClock(clock), WithAlgorithm(TokenBucket), WithBurst(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := admitted(r, 10); got != 5 {
+		t.Fatalf("%d calls admitted at once, want a burst of 5", got)
+	}
+	for range 3 {
+		clock.Advance(time.Second)
+		if got := admitted(r, 3); got != 1 {
+			t.Fatalf("%d calls admitted after 1s, want 1", got)
+		}
+	}
+	// the bucket holds no more than the burst after an idle time
+	clock.Advance(time.Hour)
+	if got := admitted(r, 10); got != 5 {
+		t.Fatalf("%d calls admitted after an idle time, want 5", got)
+	}
+}
+
+func TestBurstInvalid(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithAlgorithm(TokenBucket), WithBurst(0)},
+		{WithAlgorithm(TokenBucket), WithBurst(-1)},
+		{WithBurst(5)},
+	} {
+		if _, err := New(context.Background(), time.Second, 1, opts...); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("New() = %v, want ErrInvalidParams", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxSensibleRate is the rate, in calls per second, above which a configuration is
+// considered a mistake (e.g. a limit of a million per nanosecond): no process can
+// serve that many calls, the limiter would never limit anything.
+const MaxSensibleRate = 1e8
+
+// WithStrictValidation makes New (and SetLimit) return an error wrapping ErrInvalidParams
+// when the rate is above MaxSensibleRate. By default, such a rate only logs a warning.
+func WithStrictValidation() Option {
+	return func(r *RateLimit) {
+		r.strict = true
+	}
+}
+
+// checkRate warns about, or rejects in strict mode, a rate of limit calls per d above
+// MaxSensibleRate
+func (r *RateLimit) checkRate(limit int, d time.Duration) error {
+	rate := float64(limit) / d.Seconds()
+	if rate <= MaxSensibleRate {
+		return nil
+	}
+	if r.strict {
+		return fmt.Errorf("%w: %d calls per %v is more than %g calls per second", ErrInvalidParams, limit, d, float64(MaxSensibleRate))
+	}
+	r.log.Warn("Rate above MaxSensibleRate, it is probably a mistake", "limit", limit, "duration", d, "max", float64(MaxSensibleRate))
+	return nil
+}
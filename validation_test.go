@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAbsurdRateWarnsByDefault(t *testing.T) {
+	var logs syncBuffer
+	r, err := New(context.Background(), time.Millisecond, 1_000_000, WithLogger(debugLogger(&logs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if logs.count("Rate above MaxSensibleRate") != 1 {
+		t.Fatal("no warning about the rate")
+	}
+	// a sensible rate is not reported
+	if err := r.SetLimit(1000); err != nil || logs.count("Rate above MaxSensibleRate") != 1 {
+		t.Fatalf("SetLimit(1000) = %v, or warned", err)
+	}
+}
+
+func TestAbsurdRateRejectedWithStrictValidation(t *testing.T) {
+	if _, err := New(context.Background(), time.Millisecond, 1_000_000, WithStrictValidation()); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("New() = %v, want ErrInvalidParams", err)
+	}
+	r, err := New(context.Background(), time.Millisecond, 1000, WithStrictValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err := r.SetLimit(1_000_000); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("SetLimit() = %v, want ErrInvalidParams", err)
+	}
+	if r.Remaining() != 1000 {
+		t.Fatal("the rejected limit was applied")
+	}
+}
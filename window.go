@@ -0,0 +1,52 @@
+package ratelimit
+
+import "time"
+
+// availableLocked returns the number of slots of the main window available now,
+// r.mu must be held
+func (r *RateLimit) availableLocked(now time.Time) int {
+	switch r.algorithm {
+	case GCRA, LeakyBucket:
+		return r.gcraAvailableLocked(now)
+	case TokenBucket:
+		return r.bucketAvailableLocked(now)
+	case SlidingWindowLog:
+		return r.logAvailableLocked(now)
+	default:
+		return cap(r.ch) - len(r.ch)
+	}
+}
+
+// consumeLocked consumes n available slots of the main window, r.mu must be held for writing.
+// All the sends to r.ch are done with r.mu held so the slots cannot be taken in between.
+func (r *RateLimit) consumeLocked(n int, now time.Time) {
+	switch r.algorithm {
+	case GCRA, LeakyBucket:
+		r.gcraConsumeLocked(n, now)
+	case TokenBucket:
+		r.bucketConsumeLocked(n, now)
+	case SlidingWindowLog:
+		r.logConsumeLocked(n, now)
+	default:
+		for i := 0; i < n; i++ {
+			r.ch <- struct{}{}
+		}
+	}
+}
+
+// mainDelayLocked returns how long to wait before n slots of the main window are available,
+// r.mu must be held
+func (r *RateLimit) mainDelayLocked(now time.Time, n int) time.Duration {
+	switch {
+	case r.availableLocked(now) >= n:
+		return 0
+	case r.algorithm == GCRA, r.algorithm == LeakyBucket:
+		return r.gcraDelayLocked(now, n)
+	case r.algorithm == TokenBucket:
+		return r.bucketDelayLocked(now, n)
+	case r.algorithm == SlidingWindowLog:
+		return r.logDelayLocked(now, n)
+	default:
+		return r.untilResetLocked()
+	}
+}